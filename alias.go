@@ -0,0 +1,131 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var checkAliasFlag = flag.Bool("check-aliases", false, "report account aliases sharing a target and payee aliases with several targets in the journals given")
+
+// An alias directive of a journal, mapping from to to
+type alias struct {
+	file string
+	line int
+	from string
+	to   string
+}
+
+func (a alias) String() string {
+	return fmt.Sprintf("%v:%v: alias %v=%v", a.file, a.line, a.from, a.to)
+}
+
+func (a alias) problem(message string) finding {
+	return finding{rule: "alias", title: "Alias problems", message: message, file: a.file, line: a.line}
+}
+
+// journalAliases returns the account and payee aliases defined in the
+// journal b. Account aliases are "alias from=to" or an "alias from" line under
+// "account to", payee aliases an "alias from" line under "payee to".
+func journalAliases(fileName string, b []byte) (accounts, payees []alias) {
+	var directive, name string
+	for i, line := range strings.Split(string(b), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		keyword, rest, _ := strings.Cut(trimmed, " ")
+		rest = strings.TrimSpace(rest)
+		if line[0] != ' ' && line[0] != '\t' {
+			directive, name = keyword, rest
+			if keyword == "alias" {
+				from, to, ok := strings.Cut(rest, "=")
+				if ok {
+					accounts = append(accounts, alias{fileName, i + 1, strings.TrimSpace(from), strings.TrimSpace(to)})
+				}
+			}
+			continue
+		}
+		if keyword != "alias" {
+			continue
+		}
+		a := alias{fileName, i + 1, rest, name}
+		switch directive {
+		case "account":
+			accounts = append(accounts, a)
+		case "payee":
+			payees = append(payees, a)
+		}
+	}
+	return accounts, payees
+}
+
+// readJournals calls f with the content of each journal among fileNames,
+// skipping XML, emacs and time files
+func readJournals(fileNames []string, f func(fileName string, b []byte)) error {
+	for _, fileName := range fileNames {
+		if isTimeFile(fileName) {
+			continue
+		}
+		b, err := readInput(fileName)
+		if err != nil {
+			return err
+		}
+		if content := strings.TrimSpace(string(b)); strings.HasPrefix(content, "<") || strings.HasPrefix(content, "(") {
+			continue
+		}
+		f(fileName, b)
+	}
+	return nil
+}
+
+// checkAliases reads the journals among fileNames and returns their account
+// aliases with the same target, silently merging accounts, and payee aliases
+// with different targets, silently splitting payees
+func checkAliases(fileNames []string) (problems []finding, err error) {
+	var accounts, payees []alias
+	err = readJournals(fileNames, func(fileName string, b []byte) {
+		a, p := journalAliases(fileName, b)
+		accounts = append(accounts, a...)
+		payees = append(payees, p...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byTarget := make(map[string]alias)
+	for _, a := range accounts {
+		if first, exists := byTarget[a.to]; exists && first.from != a.from {
+			problems = append(problems, a.problem(fmt.Sprintf("alias %v=%v has the same target as %v", a.from, a.to, first)))
+			continue
+		}
+		byTarget[a.to] = a
+	}
+	bySource := make(map[string]alias)
+	for _, p := range payees {
+		if first, exists := bySource[p.from]; exists && first.to != p.to {
+			problems = append(problems, p.problem(fmt.Sprintf("alias %v=%v has a different target than %v", p.from, p.to, first)))
+			continue
+		}
+		bySource[p.from] = p
+	}
+	return problems, nil
+}
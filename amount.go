@@ -0,0 +1,303 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Amounts are computed as exact decimals and postings keep theirs in
+// Quantity, as the canonical decimal that keys their bucket, with their
+// commodity, and that amounts are compared by. Amount is the closest float64, for arithmetic and display
+// only.
+
+// An amountKey is the canonical decimal of an amount followed by its
+// commodity, if any, like "-10.5 EUR" or "0", keying the buckets of postings
+// with the same amount in the same commodity
+type amountKey string
+
+// newAmountKey returns the key of the amount quantity, a canonical decimal, in
+// commodity. Decimals have no spaces, so the first one ends the quantity.
+func newAmountKey(quantity, commodity string) amountKey {
+	if commodity == "" {
+		return amountKey(quantity)
+	}
+	return amountKey(quantity + " " + commodity)
+}
+
+// parseAmount parses a ledger amount like "£10.00", "-10,00 EUR" or
+// "1,234.5 \"ABC 1\"", returning its quantity and commodity. Lot annotations
+// and costs (after "{", "[", "(" or "@") are ignored.
+func parseAmount(s string) (float64, string, error) {
+	q, commodity, err := parseDecimal(s)
+	if err != nil {
+		return 0, "", err
+	}
+	return toFloat(q), commodity, nil
+}
+
+// parseDecimal is parseAmount with the exact quantity
+func parseDecimal(s string) (*big.Rat, string, error) {
+	orig := s
+	if i := strings.IndexAny(s, "{[(@"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+
+	negative := false
+	if strings.HasPrefix(s, "-") {
+		negative = true
+		s = strings.TrimSpace(s[1:])
+	}
+
+	isNumber := func(r rune) bool {
+		return unicode.IsDigit(r) || r == '.' || r == ',' || r == '-'
+	}
+	var commodity, number string
+	if strings.HasPrefix(s, "\"") {
+		end := strings.Index(s[1:], "\"")
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated commodity in amount %q", orig)
+		}
+		commodity = s[1 : end+1]
+		number = strings.TrimSpace(s[end+2:])
+	} else if i := strings.IndexFunc(s, isNumber); i > 0 {
+		commodity = strings.TrimSpace(s[:i])
+		number = strings.TrimSpace(s[i:])
+	} else {
+		i := strings.IndexFunc(s, func(r rune) bool { return !isNumber(r) })
+		if i < 0 {
+			i = len(s)
+		}
+		number = s[:i]
+		commodity = strings.Trim(strings.TrimSpace(s[i:]), "\"")
+	}
+	if strings.HasPrefix(number, "-") {
+		negative = !negative
+		number = number[1:]
+	}
+
+	q, ok := new(big.Rat).SetString(normalizeNumber(number))
+	if !ok || strings.ContainsAny(number, "eE/") {
+		return nil, "", fmt.Errorf("invalid amount %q", orig)
+	}
+	if negative {
+		q.Neg(q)
+	}
+	return q, commodity, nil
+}
+
+// decimal returns the exact decimal value of amount, the shortest decimal
+// with amount as its closest float64
+func decimal(amount float64) *big.Rat {
+	q, ok := new(big.Rat).SetString(strconv.FormatFloat(amount, 'f', -1, 64))
+	if !ok {
+		// Infinities and NaN, from durations or scripts
+		return new(big.Rat)
+	}
+	return q
+}
+
+// decimalString returns the canonical decimal of q, with no trailing zeros,
+// or a fraction like 1/3 when q has no finite decimal expansion
+func decimalString(q *big.Rat) string {
+	// q has as many decimals as the largest power of 2 or 5 in its
+	// denominator
+	d := new(big.Int).Set(q.Denom())
+	digits := 0
+	var m big.Int
+	for _, f := range []int64{10, 2, 5} {
+		factor := big.NewInt(f)
+		for d.Cmp(big.NewInt(1)) != 0 {
+			quo, _ := new(big.Int).QuoRem(d, factor, &m)
+			if m.Sign() != 0 {
+				break
+			}
+			d, digits = quo, digits+1
+		}
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return q.RatString()
+	}
+	return q.FloatString(digits)
+}
+
+// setQuantity sets the amount of tx to q
+func (tx *Tx) setQuantity(q *big.Rat) {
+	tx.Amount, tx.Quantity = toFloat(q), decimalString(q)
+}
+
+// exact returns the amount of tx as an exact decimal
+func (tx *Tx) exact() *big.Rat {
+	if tx.Quantity != "" {
+		if q, ok := new(big.Rat).SetString(tx.Quantity); ok {
+			return q
+		}
+	}
+	return decimal(tx.Amount)
+}
+
+// quantity returns the canonical decimal of the amount of tx
+func (tx *Tx) quantity() string {
+	if tx.Quantity != "" {
+		return tx.Quantity
+	}
+	return decimalString(decimal(tx.Amount))
+}
+
+// key returns the key of the bucket of tx, the canonical decimal of its
+// amount and its commodity
+func (tx *Tx) key() amountKey {
+	return newAmountKey(tx.quantity(), tx.Commodity)
+}
+
+// compareAmounts compares the amounts of a and b exactly, returning -1, 0 or
+// +1 like big.Rat.Cmp
+func compareAmounts(a, b *Tx) int {
+	if a.quantity() == b.quantity() {
+		return 0
+	}
+	return a.exact().Cmp(b.exact())
+}
+
+// parseNumber parses a plain decimal number like -10.5 or 1e3, refusing the
+// fractions, hexadecimal numbers, infinities and NaN that big.Rat and
+// strconv also accept
+func parseNumber(s string) (*big.Rat, error) {
+	if strings.IndexFunc(s, func(r rune) bool { return !strings.ContainsRune("0123456789.eE+-", r) }) >= 0 {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	q, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return q, nil
+}
+
+// sortedKeys returns the keys of txs by the amount of the first posting of
+// their bucket, then by key
+func sortedKeys(txs map[amountKey][]Tx) []amountKey {
+	keys := make([]amountKey, 0, len(txs))
+	for k := range txs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := txs[keys[i]], txs[keys[j]]
+		if len(a) > 0 && len(b) > 0 {
+			if c := compareAmounts(&a[0], &b[0]); c != 0 {
+				return c < 0
+			}
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// jsonNumber returns the canonical decimal q as a JSON number, or the closest
+// float64 of fractions like 1/3, which have no decimal
+func jsonNumber(q string) json.Number {
+	if r, ok := new(big.Rat).SetString(q); ok && strings.Contains(q, "/") {
+		return json.Number(strconv.FormatFloat(toFloat(r), 'g', -1, 64))
+	}
+	return json.Number(q)
+}
+
+// MarshalJSON writes the amount of tx as its exact decimal rather than as
+// Amount
+func (tx *Tx) MarshalJSON() ([]byte, error) {
+	type plain Tx
+	return json.Marshal(struct {
+		*plain
+		Amount json.Number `json:"amount"`
+	}{(*plain)(tx), jsonNumber(tx.quantity())})
+}
+
+// MarshalJSON writes the amount of p as its exact decimal rather than as
+// Amount
+func (p Posting) MarshalJSON() ([]byte, error) {
+	type plain Posting
+	q := p.Quantity
+	if q == "" {
+		q = decimalString(decimal(p.Amount))
+	}
+	return json.Marshal(struct {
+		plain
+		Amount json.Number `json:"amount"`
+	}{plain(p), jsonNumber(q)})
+}
+
+// toFloat returns the float64 closest to q
+func toFloat(q *big.Rat) float64 {
+	f, _ := q.Float64()
+	return f
+}
+
+// amountDelta returns the difference between the amounts of a and b, as a
+// non-negative amount, computed exactly
+func amountDelta(a, b *Tx) float64 {
+	if a.quantity() == b.quantity() {
+		return 0
+	}
+	return math.Abs(toFloat(new(big.Rat).Sub(a.exact(), b.exact())))
+}
+
+// normalizeNumber turns a number with thousands separators and either a
+// decimal point or a decimal comma into one strconv understands. When only
+// one kind of separator is present, it is a decimal mark unless followed by
+// exactly three digits.
+func normalizeNumber(n string) string {
+	lastDot := strings.LastIndex(n, ".")
+	lastComma := strings.LastIndex(n, ",")
+	decimal := ""
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastDot > lastComma {
+			decimal = "."
+		} else {
+			decimal = ","
+		}
+	case lastComma >= 0:
+		if strings.Count(n, ",") == 1 && len(n)-lastComma-1 != 3 {
+			decimal = ","
+		}
+	case lastDot >= 0:
+		if strings.Count(n, ".") == 1 {
+			decimal = "."
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range n {
+		switch {
+		case decimal != "" && i == strings.LastIndex(n, decimal):
+			b.WriteRune('.')
+		case r == '.' || r == ',':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
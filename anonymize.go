@@ -0,0 +1,190 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var anonymize = flag.Bool("anonymize", false, "replace accounts, files, metadata and tags of the report by hashes, encipher payees, shift dates and amounts, consistently within the run, to share the report")
+var anonymizeInputs = flag.String("anonymize-inputs", "", "with -anonymize, also write the XML inputs, anonymized like the report, to this `directory`")
+
+// file replaces the name of file, keeping its extension
+func (a *anonymizer) file(file string) string {
+	if file == "" {
+		return file
+	}
+	return a.text(file) + filepath.Ext(file)
+}
+
+// tx returns an anonymized copy of tx. The ignored tag is kept, for the
+// report to show it.
+func (a *anonymizer) tx(ignoredTag string, tx *Tx) *Tx {
+	anonymized := *tx
+	anonymized.Date = a.date(tx.Date)
+	anonymized.Input = a.file(tx.Input)
+	anonymized.File = a.file(tx.File)
+	anonymized.Payee = a.payee(tx.Payee)
+	anonymized.Account = a.account(tx.Account)
+	if tx.Note != "" {
+		anonymized.Note = a.text(tx.Note)
+	}
+	anonymized.setQuantity(a.decimal(tx.exact()))
+	if tx.Postings != nil {
+		anonymized.Postings = make([]Posting, len(tx.Postings))
+		for i, p := range tx.Postings {
+			q := a.decimal(p.exact())
+			anonymized.Postings[i] = Posting{Account: a.account(p.Account), Amount: toFloat(q), Commodity: p.Commodity, Quantity: decimalString(q)}
+		}
+	}
+	if tx.Assertion != nil {
+		assertion := a.amount(*tx.Assertion)
+		anonymized.Assertion = &assertion
+	}
+	tags := func(tags []string) (anonymized []string) {
+		for _, tag := range tags {
+			if tag != ignoredTag {
+				tag = a.text(tag)
+			}
+			anonymized = append(anonymized, tag)
+		}
+		return anonymized
+	}
+	anonymized.Tags = tags(tx.Tags)
+	anonymized.PostingTags = tags(tx.PostingTags)
+	if tx.Metadata != nil {
+		anonymized.Metadata = make(map[string]string, len(tx.Metadata))
+		for k, v := range tx.Metadata {
+			anonymized.Metadata[k] = a.text(v)
+		}
+	}
+	return &anonymized
+}
+
+// amount is decimal for amount
+func (a *anonymizer) amount(amount float64) float64 {
+	return toFloat(a.decimal(decimal(amount)))
+}
+
+// findings returns anonymized copies of findings. Payees and accounts in
+// titles are replaced like in postings, while messages are replaced whole.
+func (a *anonymizer) findings(ignoredTag string, findings []finding) []finding {
+	anonymized := make([]finding, 0, len(findings))
+	for _, f := range findings {
+		f.file = a.file(f.file)
+		if f.message != "" {
+			f.message = a.text(f.message)
+		}
+		txs := make([]*Tx, 0, len(f.txs))
+		for _, tx := range f.txs {
+			if tx.Account != "" {
+				f.title = strings.ReplaceAll(f.title, tx.Account, a.account(tx.Account))
+			}
+			if tx.Payee != "" {
+				f.title = strings.ReplaceAll(f.title, tx.Payee, a.payee(tx.Payee))
+			}
+			if m := memo(tx.Note); m != "" {
+				f.title = strings.ReplaceAll(f.title, m, a.text(m))
+			}
+			txs = append(txs, a.tx(ignoredTag, tx))
+		}
+		if f.txs != nil {
+			f.txs = txs
+		}
+		anonymized = append(anonymized, f)
+	}
+	return anonymized
+}
+
+// anonymizeDocument returns b, the output of `ledger xml`, anonymized but
+// for the ignored tag, for the same groups to be reported
+func anonymizeDocument(a *anonymizer, ignoredTag string, b []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	var stack []string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 {
+				break
+			}
+			if name := stack[len(stack)-1]; name != "tag" || string(t) != ignoredTag {
+				tok = xml.CharData(a.element(name, string(t)))
+			}
+		}
+		if err := enc.EncodeToken(xml.CopyToken(tok)); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeAnonymizedInputs writes the inputs among fileNames to dir as XML,
+// anonymized with a, under their anonymized names. Time files are skipped.
+func writeAnonymizedInputs(a *anonymizer, ignoredTag string, fileNames []string, ledgerArgs, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		if isTimeFile(fileName) {
+			slog.Warn("time files cannot be anonymized, skipping", "file", fileName)
+			continue
+		}
+		b, err := readInput(fileName)
+		if err == nil && !strings.HasPrefix(strings.TrimSpace(string(b)), "<") {
+			b, err = exportXML(fileName, ledgerArgs)
+		}
+		if err != nil {
+			return err
+		}
+		doc, err := anonymizeDocument(a, ignoredTag, b)
+		if err != nil {
+			return fmt.Errorf("%v: %w", fileName, err)
+		}
+		name := filepath.Join(dir, strings.TrimSuffix(a.file(fileName), filepath.Ext(fileName))+".xml")
+		if err := ioutil.WriteFile(name, doc, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
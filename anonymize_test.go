@@ -0,0 +1,96 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// scanGroups returns the groups of duplicates of postings as the scan finds
+// them, with match and tolerance t
+func scanGroups(match Matcher, t tolerance, postings []Tx) string {
+	txs := make(map[amountKey][]Tx)
+	for _, tx := range postings {
+		txs[tx.key()] = append(txs[tx.key()], tx)
+	}
+	if t.enabled() {
+		txs = toleranceBuckets(txs, t)
+		match = allOf(match, amountWithin(t))
+	}
+	groups := findDuplicates(2, match, 10, "notDup", txs)
+	if t.enabled() {
+		groups = mergeGroups(groups)
+	}
+	return groupSet(groups)
+}
+
+func TestAnonymizedReport(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	// Around the end of February of a leap year
+	start := time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)
+	var postings []Tx
+	for i := 0; i < 300; i++ {
+		tx := Tx{Tx: dedupe.Tx{
+			Date:      start.AddDate(0, 0, r.Intn(30)),
+			Payee:     []string{"Coffee", "COFFEE SHOP 12", "Bakery", "Amazon.com*1234", "AMAZON MKTPLACE"}[r.Intn(5)],
+			Account:   []string{"Assets:Bank", "Expenses:Food"}[r.Intn(2)],
+			Commodity: "EUR",
+		}, Position: i}
+		tx.setQuantity(big.NewRat(int64(r.Intn(41)-20)*5, 100))
+		postings = append(postings, tx)
+	}
+	a, err := newAnonymizer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var anonymized []Tx
+	for i := range postings {
+		anonymized = append(anonymized, *a.tx("notDup", &postings[i]))
+	}
+
+	for _, c := range []struct {
+		matchers, tolerance string
+	}{
+		{"window", "0"},
+		{"exact", "0"},
+		{"window,fuzzy-payee", "0"},
+		{"window", "0.05"},
+	} {
+		t.Run(c.matchers+" "+c.tolerance, func(t *testing.T) {
+			match, err := newMatcher(c.matchers, dedupe.MatchOptions{MaxDays: 10, PayeeSimilarity: 0.6})
+			if err != nil {
+				t.Fatal(err)
+			}
+			match = allOf(sameCommodity, match)
+			var tol tolerance
+			if err := tol.Set(c.tolerance); err != nil {
+				t.Fatal(err)
+			}
+			want := scanGroups(match, tol, postings)
+			if got := scanGroups(match, tol, anonymized); got != want {
+				t.Errorf("anonymized groups %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+)
+
+var auditFile = flag.String("audit-file", "", "record in this `file`, as JSON lines, every posting left out of the search and every group of postings left out of the report, and why")
+
+// auditLog records what is left out, with -audit-file
+var auditLog *slog.Logger
+
+// openAudit starts recording what is left out to fileName
+func openAudit(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	auditLog = slog.New(slog.NewJSONHandler(f, nil))
+	return nil
+}
+
+// audit records that txs were left out of the search, for reason
+func audit(reason string, txs ...*Tx) {
+	if auditLog == nil {
+		return
+	}
+	for _, tx := range txs {
+		auditLog.Info("posting skipped", "reason", reason, "position", tx.position(), "date", tx.Date.Format("2006-01-02"),
+			"payee", tx.Payee, "account", tx.Account, "amount", tx.Amount, "commodity", tx.Commodity)
+	}
+}
+
+// auditGroup records that the group of txs, a finding of rule, was left out
+// of the report, for reason
+func auditGroup(reason string, rule string, txs []*Tx) {
+	if auditLog == nil {
+		return
+	}
+	postings := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		postings = append(postings, tx.position())
+	}
+	auditLog.Info("group skipped", "reason", reason, "rule", rule, "fingerprint", fingerprint(txs...), "postings", postings)
+}
@@ -0,0 +1,108 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import "flag"
+
+var basePath = flag.String("base", "", "with -candidate, the ledger `file` to compare it against, in addition to the files given")
+var candidatePath = flag.String("candidate", "", "only report postings of this `file`, like a new import, duplicating postings of -base")
+
+// withCandidate returns fileNames with base and candidate, candidate last
+func withCandidate(fileNames []string, base, candidate string) []string {
+	if base != "" {
+		fileNames = append(fileNames, base)
+	}
+	fileNames = uniqueFiles(fileNames)
+	if candidate == "" {
+		if base != "" {
+			usageError("-base needs -candidate")
+		}
+		return fileNames
+	}
+	if len(fileNames) == 0 {
+		usageError("-candidate needs -base or files to compare it against")
+	}
+	if len(uniqueFiles(append(fileNames, candidate))) == len(fileNames) {
+		fatal("the candidate is also a base file", "candidate", candidate)
+	}
+	return append(fileNames, candidate)
+}
+
+// fromCandidate reports whether txs has both postings of candidate and
+// postings of the base files
+func fromCandidate(candidate string, txs []*Tx) bool {
+	var inCandidate, inBase bool
+	for _, tx := range txs {
+		if tx.Input == candidate {
+			inCandidate = true
+		} else {
+			inBase = true
+		}
+	}
+	return inCandidate && inBase
+}
+
+// candidateBuckets returns the buckets of txs with both postings of
+// candidate and postings of the base files, the only ones where candidateGroups
+// can find some. Most postings of an import are not in the base files, and
+// this skips comparing those of the base files between themselves.
+func candidateBuckets(candidate string, txs map[amountKey][]Tx) map[amountKey][]Tx {
+	kept := make(map[amountKey][]Tx)
+	for key, bucket := range txs {
+		var inCandidate, inBase bool
+		for i := range bucket {
+			if bucket[i].Input == candidate {
+				inCandidate = true
+			} else {
+				inBase = true
+			}
+		}
+		if inCandidate && inBase {
+			kept[key] = bucket
+		}
+	}
+	return kept
+}
+
+// candidateGroups returns groups with postings of candidate duplicating
+// postings of the base files, without those within the base files, already
+// reviewed, or within candidate
+func candidateGroups(candidate string, groups [][]*Tx) (kept [][]*Tx) {
+	for _, g := range groups {
+		if fromCandidate(candidate, g) {
+			kept = append(kept, g)
+		} else {
+			auditGroup("no posting of -candidate duplicating one of -base", "duplicate", g)
+		}
+	}
+	return kept
+}
+
+// candidateFindings returns findings with postings of candidate and postings
+// of the base files, like candidateGroups
+func candidateFindings(candidate string, findings []finding) (kept []finding) {
+	for _, f := range findings {
+		if fromCandidate(candidate, f.txs) {
+			kept = append(kept, f)
+		} else {
+			auditGroup("no posting of -candidate duplicating one of -base", f.rule, f.txs)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,107 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCandidate(t *testing.T) {
+	dir := t.TempDir()
+	base, candidate := filepath.Join(dir, "main.ledger"), filepath.Join(dir, "import.ledger")
+	err := os.WriteFile(base, []byte(`2024/03/01 Shop
+    Expenses:Food  10 EUR
+    Assets:Bank
+
+2024/03/10 Rent
+    Expenses:Rent  500 EUR
+    Assets:Bank
+
+2024/03/11 Rent
+    Expenses:Rent  500 EUR
+    Assets:Bank
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The cinemas duplicate each other, but not a posting of the base
+	err = os.WriteFile(candidate, []byte(`2024/03/01 Shop
+    Expenses:Food  10 EUR
+    Assets:Bank
+
+2024/03/05 Cinema
+    Expenses:Leisure  12 EUR
+    Assets:Bank
+
+2024/03/05 Cinema
+    Expenses:Leisure  12 EUR
+    Assets:Bank
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := runCommand(t, "-parser", "native", "-format", "json", "-base", base, "-candidate", candidate)
+	var report struct {
+		Findings []struct {
+			Postings []struct {
+				Account, File string
+			}
+		}
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if len(report.Findings) != 2 {
+		t.Fatalf("got %v findings, want 2, for both accounts of the shop: %s", len(report.Findings), out)
+	}
+	for _, f := range report.Findings {
+		if len(f.Postings) != 2 {
+			t.Fatalf("got %v postings, want 2", len(f.Postings))
+		}
+		files := map[string]bool{}
+		for _, p := range f.Postings {
+			if p.Account != "Expenses:Food" && p.Account != "Assets:Bank" {
+				t.Errorf("got posting to %v, want only those of the shop", p.Account)
+			}
+			files[filepath.Base(p.File)] = true
+		}
+		if !files["main.ledger"] || !files["import.ledger"] {
+			t.Errorf("got postings of %v, want one of the base and one of the candidate", files)
+		}
+	}
+}
+
+func TestCandidateBuckets(t *testing.T) {
+	tx := func(input string) Tx {
+		var tx Tx
+		tx.Input = input
+		return tx
+	}
+	buckets := candidateBuckets("import.ledger", map[amountKey][]Tx{
+		newAmountKey("10", "EUR"):  {tx("main.ledger"), tx("import.ledger")},
+		newAmountKey("12", "EUR"):  {tx("import.ledger"), tx("import.ledger")},
+		newAmountKey("500", "EUR"): {tx("main.ledger"), tx("main.ledger")},
+	})
+	if len(buckets) != 1 || len(buckets[newAmountKey("10", "EUR")]) != 2 {
+		t.Errorf("got buckets %v, want only the one of the shop", buckets)
+	}
+}
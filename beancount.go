@@ -0,0 +1,340 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// isBeancount tells whether fileName is a Beancount file, by its extension or
+// with -parser beancount
+func isBeancount(fileName string) bool {
+	switch filepath.Ext(fileName) {
+	case ".beancount", ".bean":
+		return true
+	}
+	return *parser == "beancount"
+}
+
+// beancountHeader matches the first line of a Beancount transaction, with
+// its date, flag and the rest of the line
+var beancountHeader = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\s+(\*|!|txn)(?:\s+(.*))?$`)
+
+// beancountString matches the quoted strings of a transaction header, the
+// payee and narration
+var beancountString = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+
+type beancountParser struct {
+	txs      map[amountKey][]Tx
+	position int
+	reading  map[string]bool
+	// pushed are the tags of pushtag directives
+	pushed []string
+
+	// The transaction being read, if header is set
+	header   *Tx
+	postings []beancountPosting
+}
+
+type beancountPosting struct {
+	Tx
+	// elided postings have no amount, for it to be computed from the others
+	elided bool
+	// weight is the amount the posting contributes to the balance of the
+	// transaction, in the commodity of its cost or price if any
+	weight          *big.Rat
+	weightCommodity string
+}
+
+// parseBeancount returns the postings of the Beancount file fileName, with b
+// its content, by amount. Postings of open, balance, pad and other directives
+// than transactions are not read.
+func parseBeancount(fileName string, b []byte) (map[amountKey][]Tx, error) {
+	p := beancountParser{txs: make(map[amountKey][]Tx), reading: make(map[string]bool)}
+	if err := p.parse(fileName, b); err != nil {
+		return nil, err
+	}
+	return p.txs, nil
+}
+
+func (p *beancountParser) parse(fileName string, b []byte) error {
+	if abs, err := filepath.Abs(fileName); err == nil {
+		if p.reading[abs] {
+			return fmt.Errorf("%v: included recursively", fileName)
+		}
+		p.reading[abs] = true
+		defer delete(p.reading, abs)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(text)
+		if i := commentStart(trimmed); i >= 0 {
+			trimmed = strings.TrimSpace(trimmed[:i])
+		}
+		indented := text != "" && (text[0] == ' ' || text[0] == '\t')
+
+		if indented {
+			if p.header != nil && trimmed != "" {
+				if err := p.indented(fileName, line, trimmed); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := p.end(); err != nil {
+			return err
+		}
+		if trimmed == "" {
+			continue
+		}
+
+		if m := beancountHeader.FindStringSubmatch(trimmed); m != nil {
+			date, err := time.Parse("2006-01-02", m[1])
+			if err != nil {
+				return fmt.Errorf("%v:%v: %w", fileName, line, err)
+			}
+			p.header = &Tx{Tx: dedupe.Tx{Date: date, File: fileName, Line: line}, Position: p.position, State: journalStates[m[2][0]]}
+			p.position++
+			strs := beancountString.FindAllStringSubmatch(m[3], -1)
+			switch len(strs) {
+			case 0:
+			case 1:
+				p.header.Payee = unquoteBeancount(strs[0][1])
+			default:
+				p.header.Payee, p.header.Note = unquoteBeancount(strs[0][1]), unquoteBeancount(strs[1][1])
+			}
+			p.header.Tags = append([]string(nil), p.pushed...)
+			for _, word := range strings.Fields(beancountString.ReplaceAllString(m[3], "")) {
+				if tag, ok := strings.CutPrefix(word, "#"); ok {
+					p.header.Tags = append(p.header.Tags, tag)
+				} else if link, ok := strings.CutPrefix(word, "^"); ok {
+					p.meta(p.header, "link", link)
+				}
+			}
+			continue
+		}
+
+		keyword, rest, _ := strings.Cut(trimmed, " ")
+		rest = strings.TrimSpace(rest)
+		switch keyword {
+		case "include":
+			included := unquoteBeancount(strings.Trim(rest, `"`))
+			if !filepath.IsAbs(included) {
+				included = filepath.Join(filepath.Dir(fileName), included)
+			}
+			b, err := ioutil.ReadFile(included)
+			if err != nil {
+				return fmt.Errorf("%v:%v: %w", fileName, line, err)
+			}
+			if err := p.parse(included, b); err != nil {
+				return err
+			}
+		case "pushtag":
+			p.pushed = append(p.pushed, strings.TrimPrefix(rest, "#"))
+		case "poptag":
+			tag := strings.TrimPrefix(rest, "#")
+			for i := len(p.pushed) - 1; i >= 0; i-- {
+				if p.pushed[i] == tag {
+					p.pushed = append(p.pushed[:i], p.pushed[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%v: %w", fileName, err)
+	}
+	return p.end()
+}
+
+// commentStart returns the index of the ; starting a comment in s, outside
+// of strings, or -1
+func commentStart(s string) int {
+	quoted := false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ';' && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteBeancount(s string) string {
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+}
+
+// meta sets the metadata key of tx to value
+func (p *beancountParser) meta(tx *Tx, key, value string) {
+	if tx.Metadata == nil {
+		tx.Metadata = make(map[string]string)
+	}
+	tx.Metadata[key] = value
+}
+
+// indented reads a posting or metadata line of the current transaction
+func (p *beancountParser) indented(fileName string, line int, trimmed string) error {
+	if key, value, ok := strings.Cut(trimmed, ":"); ok && beancountKey.MatchString(key) {
+		value = unquoteBeancount(strings.Trim(strings.TrimSpace(value), `"`))
+		if len(p.postings) > 0 {
+			p.meta(&p.postings[len(p.postings)-1].Tx, key, value)
+		} else {
+			p.meta(p.header, key, value)
+		}
+		return nil
+	}
+
+	posting := beancountPosting{Tx: Tx{Tx: dedupe.Tx{Line: line}}}
+	if trimmed[0] == '*' || trimmed[0] == '!' {
+		posting.State = journalStates[trimmed[0]]
+		trimmed = strings.TrimSpace(trimmed[1:])
+	}
+	account, amount, _ := strings.Cut(trimmed, " ")
+	posting.Account = account
+	amount = strings.TrimSpace(amount)
+	if amount == "" {
+		posting.elided = true
+		p.postings = append(p.postings, posting)
+		return nil
+	}
+	q, commodity, err := parseDecimal(amount)
+	if err != nil {
+		return fmt.Errorf("%v:%v: %w", fileName, line, err)
+	}
+	posting.setQuantity(q)
+	posting.Commodity = commodity
+	posting.weight, posting.weightCommodity = q, commodity
+	if cost, total, ok := beancountCost(amount); ok {
+		c, costCommodity, err := parseDecimal(cost)
+		if err != nil {
+			return fmt.Errorf("%v:%v: %w", fileName, line, err)
+		}
+		if !total {
+			c.Mul(c, q)
+		} else if q.Sign() < 0 {
+			c.Neg(c.Abs(c))
+		}
+		posting.weight, posting.weightCommodity = c, costCommodity
+	}
+	p.postings = append(p.postings, posting)
+	return nil
+}
+
+// beancountKey matches metadata keys, starting with a lowercase letter
+var beancountKey = regexp.MustCompile(`^[a-z][A-Za-z0-9_-]*$`)
+
+// beancountCost returns the cost of amount, {per unit} or {{total}}, or else
+// its price, @ per unit or @@ total, telling whether it is a total
+func beancountCost(amount string) (cost string, total bool, ok bool) {
+	if i := strings.Index(amount, "{"); i >= 0 {
+		cost, total = amount[i+1:], strings.HasPrefix(amount[i+1:], "{")
+		cost = strings.TrimLeft(cost, "{")
+		if j := strings.IndexAny(cost, "},"); j >= 0 {
+			cost = cost[:j]
+		}
+		if strings.TrimSpace(cost) != "" {
+			return strings.TrimSpace(cost), total, true
+		}
+	}
+	if i := strings.Index(amount, "@"); i >= 0 {
+		cost, total = amount[i+1:], strings.HasPrefix(amount[i+1:], "@")
+		return strings.TrimSpace(strings.TrimLeft(cost, "@")), total, true
+	}
+	return "", false, false
+}
+
+// end completes the current transaction, if any, computing an elided amount,
+// and adds its postings
+func (p *beancountParser) end() error {
+	if p.header == nil {
+		return nil
+	}
+	header := p.header
+	p.header = nil
+	postings := p.postings
+	p.postings = nil
+
+	sums := make(map[string]*big.Rat)
+	var elided *beancountPosting
+	for i := range postings {
+		post := &postings[i]
+		if post.elided {
+			if elided != nil {
+				return fmt.Errorf("%v:%v: more than one posting without amount", header.File, post.Line)
+			}
+			elided = post
+			continue
+		}
+		if sums[post.weightCommodity] == nil {
+			sums[post.weightCommodity] = new(big.Rat)
+		}
+		sums[post.weightCommodity].Add(sums[post.weightCommodity], post.weight)
+	}
+	if elided != nil {
+		if len(sums) != 1 {
+			return fmt.Errorf("%v:%v: the amount of %v cannot be computed from several commodities", header.File, elided.Line, elided.Account)
+		}
+		for commodity, sum := range sums {
+			elided.setQuantity(new(big.Rat).Neg(sum))
+			elided.Commodity = commodity
+		}
+	}
+
+	for _, post := range postings {
+		tx := post.Tx
+		tx.Date, tx.Position, tx.File, tx.Payee = header.Date, header.Position, header.File, header.Payee
+		tx.HeaderLine = header.Line
+		if tx.State == "" {
+			tx.State = header.State
+		}
+		tx.Note, tx.Tags = header.Note, header.Tags
+		if len(header.Metadata) > 0 {
+			// Posting metadata takes precedence
+			metadata := make(map[string]string, len(header.Metadata)+len(tx.Metadata))
+			for k, v := range header.Metadata {
+				metadata[k] = v
+			}
+			for k, v := range tx.Metadata {
+				metadata[k] = v
+			}
+			tx.Metadata = metadata
+		}
+		if reason := skipped(&tx); reason != "" {
+			audit(reason, &tx)
+			continue
+		}
+		p.txs[tx.key()] = append(p.txs[tx.key()], tx)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBeancount(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		journal string
+		want    []string
+		err     string
+	}{
+		{"elided amount", `2024-01-01 open Assets:Bank EUR
+
+2024-03-01 * "Shop" "Groceries" #food
+  Expenses:Food  10.50 EUR
+  Assets:Bank
+`, []string{
+			"main.beancount:4 2024-03-01 cleared Shop Expenses:Food 10.5 EUR [food]",
+			"main.beancount:5 2024-03-01 cleared Shop Assets:Bank -10.5 EUR [food]",
+		}, ""},
+		{"cost and posting state", `2024-03-01 ! "Broker"
+  Assets:Stocks  2 ACME {100 USD}
+  ! Assets:Cash
+`, []string{
+			"main.beancount:2 2024-03-01 pending Broker Assets:Stocks 2 ACME []",
+			"main.beancount:3 2024-03-01 pending Broker Assets:Cash -200 USD []",
+		}, ""},
+		{"pushed tags and comments", `pushtag #trip
+2024-03-01 txn "Hotel" ; booked online
+  Expenses:Travel  80 EUR ; two nights
+  Assets:Bank  -80 EUR
+poptag #trip
+2024-03-02 * "Bakery"
+  Expenses:Food  3 EUR
+  Assets:Bank
+`, []string{
+			"main.beancount:3 2024-03-01  Hotel Expenses:Travel 80 EUR [trip]",
+			"main.beancount:4 2024-03-01  Hotel Assets:Bank -80 EUR [trip]",
+			"main.beancount:7 2024-03-02 cleared Bakery Expenses:Food 3 EUR []",
+			"main.beancount:8 2024-03-02 cleared Bakery Assets:Bank -3 EUR []",
+		}, ""},
+		{"two elided amounts", `2024-03-01 * "Shop"
+  Expenses:Food
+  Assets:Bank
+`, nil, "main.beancount:3: more than one posting without amount"},
+		{"invalid amount", `2024-03-01 * "Shop"
+  Expenses:Food  ten EUR
+  Assets:Bank
+`, nil, "main.beancount:2"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			txs, err := parseBeancount("main.beancount", []byte(c.journal))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describePostings(txs); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got postings\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(c.want, "\n"))
+			}
+		})
+	}
+}
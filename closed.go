@@ -0,0 +1,88 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+)
+
+var closedAccounts = flag.String("closed-accounts", "", "comma-separated list of closed `accounts`, whose findings are not reported, on top of those with closed: metadata in journals")
+
+// closedMetadata is a "; closed:" comment under an account directive
+var closedMetadata = regexp.MustCompile(`^\s+;\s*closed:`)
+
+// journalClosedAccounts returns the accounts of the journal b declared with
+// closed: metadata, like
+//
+//	account Assets:Old Bank
+//	    ; closed: 2020-01-31
+func journalClosedAccounts(b []byte) (closed []string) {
+	var account string
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "account ") {
+			account = strings.TrimSpace(strings.TrimPrefix(line, "account "))
+			// Without a trailing comment
+			if i := strings.Index(account, "  ;"); i >= 0 {
+				account = strings.TrimSpace(account[:i])
+			}
+			continue
+		}
+		if account != "" && closedMetadata.MatchString(line) {
+			closed = append(closed, account)
+			account = ""
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			account = ""
+		}
+	}
+	return closed
+}
+
+// isClosed returns true if account is one of closed or a subaccount of one
+func isClosed(account string, closed []string) bool {
+	for _, c := range closed {
+		if account == c || strings.HasPrefix(account, c+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutClosed returns findings without those with a posting to a closed
+// account
+func withoutClosed(findings []finding, closed []string) (kept []finding) {
+	if len(closed) == 0 {
+		return findings
+	}
+	for _, f := range findings {
+		involved := false
+		for _, tx := range f.txs {
+			involved = involved || isClosed(tx.Account, closed)
+		}
+		if involved {
+			auditGroup("posting to a closed account", f.rule, f.txs)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,151 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// defaultConfig is read, if it exists, when -config is not given
+const defaultConfig = ".ledger-lint-duplicate.conf"
+
+// commandLineFlags returns the names of the flags set so far in fs, which
+// should be called right after parsing the command line
+func commandLineFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// commandSettings are the settings running shell commands, only read from
+// configuration files given explicitly: the default one comes with the
+// directory linted, like a clone of somebody else's journals
+var commandSettings = map[string]bool{"pre-hook": true, "post-hook": true}
+
+// A setting of a configuration file, on its line of path
+type setting struct {
+	path        string
+	line        int
+	name, value string
+}
+
+// loadConfig sets flags from the file path, made of "name = value" lines
+// and "#" comments. Flags in onCommandLine take precedence and are left
+// untouched. Unless explicit, commandSettings are refused.
+func loadConfig(path string, fs *flag.FlagSet, onCommandLine map[string]bool, explicit bool) error {
+	settings, err := readConfig(path, fs, explicit)
+	if err != nil {
+		return err
+	}
+	return applyConfig(fs, settings, onCommandLine)
+}
+
+// readConfig returns the settings of the configuration file path, checking
+// their names but not their values, see loadConfig
+func readConfig(path string, fs *flag.FlagSet, explicit bool) ([]setting, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var settings []setting
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%v:%v: expected name = value", path, line)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if fs.Lookup(name) == nil {
+			return nil, fmt.Errorf("%v:%v: unknown setting %q", path, line, name)
+		}
+		if commandSettings[name] && !explicit {
+			return nil, fmt.Errorf("%v:%v: %v runs a command, it is only read from the file given with -config", path, line, name)
+		}
+		settings = append(settings, setting{path, line, name, value})
+	}
+	return settings, scanner.Err()
+}
+
+// applyConfig sets the flags of fs to settings, but those in onCommandLine
+func applyConfig(fs *flag.FlagSet, settings []setting, onCommandLine map[string]bool) error {
+	for _, s := range settings {
+		if onCommandLine[s.name] {
+			continue
+		}
+		if err := fs.Set(s.name, s.value); err != nil {
+			return fmt.Errorf("%v:%v: %w", s.path, s.line, err)
+		}
+	}
+	return nil
+}
+
+// A resettable flag goes back to its default value with reset, for flags
+// whose Set cannot be given their default, like repeatable ones
+type resettable interface {
+	reset()
+}
+
+// resetFlags sets the flags of fs back to their default value, but those
+// in onCommandLine
+func resetFlags(fs *flag.FlagSet, onCommandLine map[string]bool) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if onCommandLine[f.Name] || f.Value.String() == f.DefValue || err != nil {
+			return
+		}
+		if r, ok := f.Value.(resettable); ok {
+			r.reset()
+			return
+		}
+		if setErr := fs.Set(f.Name, f.DefValue); setErr != nil {
+			err = fmt.Errorf("resetting %v: %w", f.Name, setErr)
+		}
+	})
+	return err
+}
+
+// runHook runs command with the shell, if not empty, with env added to the
+// environment
+func runHook(command string, env ...string) error {
+	if command == "" {
+		return nil
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q: %w", command, err)
+	}
+	return nil
+}
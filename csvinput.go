@@ -0,0 +1,185 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// csvColumns are the columns a CSV input may have
+var csvColumns = []string{"date", "payee", "account", "amount", "commodity", "note"}
+
+// A csvMap is the column, from 1, of each of csvColumns in CSV inputs
+type csvMap map[string]int
+
+func (m csvMap) String() string {
+	var columns []string
+	for name, column := range m {
+		columns = append(columns, fmt.Sprintf("%v=%v", name, column))
+	}
+	sort.Strings(columns)
+	return strings.Join(columns, ",")
+}
+
+func (m csvMap) Set(value string) error {
+	for _, c := range splitList(value) {
+		name, column, _ := strings.Cut(c, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !find(name, csvColumns) {
+			return fmt.Errorf("unknown column %q, expected one of %v", name, strings.Join(csvColumns, ", "))
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(column))
+		if err != nil || i < 1 {
+			return fmt.Errorf("invalid column %q of %v, expected a number from 1", column, name)
+		}
+		m[name] = i
+	}
+	return nil
+}
+
+func (m csvMap) reset() {
+	for name := range m {
+		delete(m, name)
+	}
+}
+
+var csvColumnMap = csvMap{}
+var csvDateFormat = flag.String("csv-date-format", "2006-01-02", "`layout` of the dates of CSV inputs, in Go format, like 02/01/2006 for 31/12/2024")
+var csvDecimal = flag.String("csv-decimal", "", "decimal `separator` of the amounts of CSV inputs, . or ,, the other being that of thousands; by default, guessed from each amount")
+
+func init() {
+	flag.Var(csvColumnMap, "csv-map", "`columns` of CSV inputs, from 1, like date=1,payee=2,account=3,amount=4; by default, those named date, payee, account, amount, commodity and note in their header")
+}
+
+// isCSV tells whether fileName is read as CSV, by its extension or with
+// -parser csv
+func isCSV(fileName string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".csv") || *parser == "csv"
+}
+
+// parseCSV reads the postings of b, CSV like a bank export, with a posting per
+// row in the columns of -csv-map, or else of its header. Fields are separated
+// by commas, or by semicolons when its first line has more of them.
+func parseCSV(fileName string, b []byte) (map[amountKey][]Tx, error) {
+	r := csv.NewReader(bytes.NewReader(b))
+	first, _, _ := bytes.Cut(b, []byte("\n"))
+	if bytes.Count(first, []byte(";")) > bytes.Count(first, []byte(",")) {
+		r.Comma = ';'
+	}
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", fileName, err)
+	}
+	if *csvDecimal != "" && *csvDecimal != "." && *csvDecimal != "," {
+		return nil, fmt.Errorf("invalid -csv-decimal %q, expected . or ,", *csvDecimal)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for name, column := range csvColumnMap {
+		columns[name] = column - 1
+	}
+	if len(columns) == 0 {
+		for i, name := range records[0] {
+			if name = strings.ToLower(strings.TrimSpace(name)); find(name, csvColumns) {
+				columns[name] = i
+			}
+		}
+		records[0] = nil
+	}
+	for _, required := range []string{"date", "amount"} {
+		if _, exists := columns[required]; !exists {
+			return nil, fmt.Errorf("%v: no %v column, set one with -csv-map", fileName, required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, exists := columns[name]; exists && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	txs := make(map[amountKey][]Tx)
+	strs := make(interner)
+	for i, record := range records {
+		if len(record) == 0 {
+			continue
+		}
+		date, err := time.Parse(*csvDateFormat, field(record, "date"))
+		if err != nil {
+			if i == 0 {
+				// A header, with -csv-map
+				continue
+			}
+			return nil, fmt.Errorf("%v:%v: %w", fileName, i+1, err)
+		}
+		amount, commodity, err := parseDecimal(csvAmount(field(record, "amount")))
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", fileName, i+1, err)
+		}
+		if c := field(record, "commodity"); c != "" {
+			commodity = c
+		}
+		tx := Tx{
+			Tx: dedupe.Tx{
+				Date:      date,
+				File:      fileName,
+				Line:      i + 1,
+				Payee:     strs.intern(field(record, "payee")),
+				Account:   strs.intern(field(record, "account")),
+				Commodity: strs.intern(commodity),
+			},
+			Position: i,
+			Note:     field(record, "note"),
+		}
+		tx.setQuantity(amount)
+		if reason := skipped(&tx); reason != "" {
+			audit(reason, &tx)
+			continue
+		}
+		txs[tx.key()] = append(txs[tx.key()], tx)
+	}
+	return txs, nil
+}
+
+// csvAmount returns amount with a dot as its decimal separator and no
+// thousands separator, with -csv-decimal. Otherwise, parseDecimal guesses
+// them, reading 1,234 as a thousand and 1.234 as one.
+func csvAmount(amount string) string {
+	switch *csvDecimal {
+	case ",":
+		return strings.ReplaceAll(strings.ReplaceAll(amount, ".", ""), ",", ".")
+	case ".":
+		return strings.ReplaceAll(amount, ",", "")
+	}
+	return amount
+}
@@ -0,0 +1,94 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		columns    string
+		dateFormat string
+		decimal    string
+		csv        string
+		want       []string
+		err        string
+	}{
+		{"header", "", "", "", `Date,Payee,Account,Amount,Commodity
+2024-03-01,Shop,Assets:Bank,-10.50,EUR
+2024-03-02,Bakery,Assets:Bank,3 USD,
+`, []string{
+			"bank.csv:2 2024-03-01  Shop Assets:Bank -10.5 EUR []",
+			"bank.csv:3 2024-03-02  Bakery Assets:Bank 3 USD []",
+		}, ""},
+		{"semicolons and columns", "date=1,payee=3,amount=2", "02/01/2006", ",", `Datum;Betrag;Empfänger
+01/03/2024;1.234,50;Shop
+02/03/2024;-0,5;Bakery
+`, []string{
+			"bank.csv:2 2024-03-01  Shop  1234.5  []",
+			"bank.csv:3 2024-03-02  Bakery  -0.5  []",
+		}, ""},
+		{"decimal point", "", "", ".", `date,amount
+2024-03-01,"1,234"
+`, []string{
+			"bank.csv:2 2024-03-01    1234  []",
+		}, ""},
+		{"no amount column", "", "", "", `date,payee
+2024-03-01,Shop
+`, nil, "no amount column"},
+		{"invalid date", "", "", "", `date,amount
+31/12/2024,10
+`, nil, "bank.csv:2"},
+		{"invalid decimal separator", "", "", "'", `date,amount
+`, nil, "invalid -csv-decimal"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer csvColumnMap.reset()
+			if c.columns != "" {
+				if err := csvColumnMap.Set(c.columns); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.dateFormat != "" {
+				defer func(format string) { *csvDateFormat = format }(*csvDateFormat)
+				*csvDateFormat = c.dateFormat
+			}
+			defer func(decimal string) { *csvDecimal = decimal }(*csvDecimal)
+			*csvDecimal = c.decimal
+
+			txs, err := parseCSV("bank.csv", []byte(c.csv))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describePostings(txs); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got postings\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(c.want, "\n"))
+			}
+		})
+	}
+}
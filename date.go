@@ -0,0 +1,76 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dates of postings are days, without a time of day or a time zone: they are
+// kept as midnight UTC and compared as a number of days, so that neither the
+// time zone of the machine nor daylight saving time moves them.
+
+// civilDate returns the day of t, in the location of t, as midnight UTC
+func civilDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// daysApart returns the number of days between the days of a and b
+func daysApart(a, b time.Time) int {
+	d := int(civilDate(b).Sub(civilDate(a)) / (24 * time.Hour))
+	if d < 0 {
+		d = -d
+	}
+	return d
+}
+
+// windowDays returns the largest number of days between duplicates, from
+// days like -days: dates being whole days, days itself only counts with
+// -inclusive
+func windowDays(days float64) int {
+	if !*inclusive {
+		return int(math.Ceil(days)) - 1
+	}
+	return int(math.Floor(days))
+}
+
+// A daysFlag sets a number of days, like -days, from a value like 10d or 10
+type daysFlag struct {
+	days *float64
+}
+
+func (f daysFlag) String() string {
+	if f.days == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f.days, 'f', -1, 64) + "d"
+}
+
+func (f daysFlag) Set(value string) error {
+	days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+	if err != nil {
+		return err
+	}
+	*f.days = days
+	return nil
+}
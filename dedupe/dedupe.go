@@ -0,0 +1,215 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package dedupe checks transactions about to be imported against those of a
+// ledger, for importers to skip the ones already there, like the -stream mode
+// of ledger-lint-duplicate does for other languages.
+//
+// An Index is built from the postings of the ledger, or read from a file
+// written with `ledger-lint-duplicate -write-index index.json journal`:
+//
+//	idx, err := dedupe.ReadIndex(f)
+//	...
+//	if v := dedupe.CheckCandidate(idx, tx); v.Duplicate {
+//		// Skip tx, already in the ledger as v.Matches
+//	}
+//
+// The matching strategies of the -matchers flag are registered by name, and
+// more can be added with RegisterMatcher, before building a chain of them
+// with NewMatcher for CheckCandidateMatching.
+package dedupe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IndexVersion is the version of the format written by WriteTo, which only
+// changes when fields are removed or change meaning
+const IndexVersion = 1
+
+// Tx is a posting, of the ledger or to be imported
+type Tx struct {
+	// Date is the day of the posting, in the location of Date: its time is
+	// ignored
+	Date    time.Time `json:"date"`
+	Payee   string    `json:"payee"`
+	Account string    `json:"account"`
+	Amount  float64   `json:"amount"`
+	// Commodity of Amount, empty when there is none
+	Commodity string `json:"commodity,omitempty"`
+	// File and Line in the journal, when known
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	// Tags of the transaction
+	Tags []string `json:"tags,omitempty"`
+	// Metadata holds the values of the transaction and posting metadata, by
+	// key
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Meta returns the value of the metadata key, compared case-insensitively
+func (tx *Tx) Meta(key string) string {
+	for k, v := range tx.Metadata {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Verdict tells whether a candidate duplicates postings of an Index, Matches
+type Verdict struct {
+	Duplicate bool `json:"duplicate"`
+	Matches   []Tx `json:"matches,omitempty"`
+}
+
+// Index holds postings by amount, to check candidates against them. It is
+// safe for concurrent use.
+type Index struct {
+	mu sync.RWMutex
+	// maxDuration is the largest time between a candidate and the postings
+	// it duplicates
+	maxDuration time.Duration
+	byAmount    map[float64][]Tx
+}
+
+// NewIndex returns an Index of txs, whose duplicates are at most maxDuration
+// apart from them, rounded down to whole days
+func NewIndex(maxDuration time.Duration, txs []Tx) *Index {
+	idx := &Index{maxDuration: maxDuration, byAmount: make(map[float64][]Tx)}
+	for _, tx := range txs {
+		idx.byAmount[tx.Amount] = append(idx.byAmount[tx.Amount], tx)
+	}
+	for _, txs := range idx.byAmount {
+		sort.SliceStable(txs, func(i, j int) bool {
+			return txs[i].Date.Before(txs[j].Date)
+		})
+	}
+	return idx
+}
+
+// Add adds tx to idx, for instance once imported, for later candidates to be
+// checked against it too
+func (idx *Index) Add(tx Tx) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	txs := append(idx.byAmount[tx.Amount], tx)
+	i := sort.Search(len(txs)-1, func(i int) bool {
+		return txs[i].Date.After(tx.Date)
+	})
+	copy(txs[i+1:], txs[i:])
+	txs[i] = tx
+	idx.byAmount[tx.Amount] = txs
+}
+
+// CheckCandidate returns the postings of existing that candidate may
+// duplicate: those with the same amount, at most the maxDuration of the index
+// apart, and with the same account and commodity, unless the account or the
+// commodity of candidate are empty.
+func CheckCandidate(existing *Index, candidate Tx) Verdict {
+	return CheckCandidateMatching(existing, candidate, nil)
+}
+
+// CheckCandidateMatching is CheckCandidate, keeping only the postings match
+// also matches with candidate, like a matcher from NewMatcher. A nil match
+// keeps them all.
+func CheckCandidateMatching(existing *Index, candidate Tx, match Matcher) Verdict {
+	existing.mu.RLock()
+	defer existing.mu.RUnlock()
+	var v Verdict
+	for _, tx := range existing.byAmount[candidate.Amount] {
+		if candidate.Account != "" && candidate.Account != tx.Account {
+			continue
+		}
+		if candidate.Commodity != "" && candidate.Commodity != tx.Commodity {
+			continue
+		}
+		if daysApart(tx.Date, candidate.Date) > int(existing.maxDuration/(24*time.Hour)) {
+			continue
+		}
+		if match == nil || match(&candidate, &tx) {
+			v.Matches = append(v.Matches, tx)
+		}
+	}
+	v.Duplicate = len(v.Matches) > 0
+	return v
+}
+
+// daysApart returns the number of days between the days of a and b, each in
+// its location, whatever the time zone offsets and daylight saving time
+func daysApart(a, b time.Time) int {
+	ya, ma, da := a.Date()
+	yb, mb, db := b.Date()
+	d := int(time.Date(yb, mb, db, 0, 0, 0, 0, time.UTC).Sub(time.Date(ya, ma, da, 0, 0, 0, 0, time.UTC)) / (24 * time.Hour))
+	if d < 0 {
+		d = -d
+	}
+	return d
+}
+
+// index is the serialized form of an Index
+type index struct {
+	Version     int    `json:"version"`
+	MaxDuration string `json:"max_duration"`
+	Postings    []Tx   `json:"postings"`
+}
+
+// WriteTo writes idx to w as JSON, with IndexVersion, to be read back with
+// ReadIndex
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	idx.mu.RLock()
+	serialized := index{Version: IndexVersion, MaxDuration: idx.maxDuration.String(), Postings: []Tx{}}
+	amounts := make([]float64, 0, len(idx.byAmount))
+	for amount := range idx.byAmount {
+		amounts = append(amounts, amount)
+	}
+	sort.Float64s(amounts)
+	for _, amount := range amounts {
+		serialized.Postings = append(serialized.Postings, idx.byAmount[amount]...)
+	}
+	idx.mu.RUnlock()
+
+	b, err := json.Marshal(serialized)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// ReadIndex reads an Index written by WriteTo from r
+func ReadIndex(r io.Reader) (*Index, error) {
+	var serialized index
+	if err := json.NewDecoder(r).Decode(&serialized); err != nil {
+		return nil, err
+	}
+	if serialized.Version != IndexVersion {
+		return nil, fmt.Errorf("index version %v, expected %v", serialized.Version, IndexVersion)
+	}
+	maxDuration, err := time.ParseDuration(serialized.MaxDuration)
+	if err != nil {
+		return nil, fmt.Errorf("index max_duration: %w", err)
+	}
+	return NewIndex(maxDuration, serialized.Postings), nil
+}
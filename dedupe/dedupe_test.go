@@ -0,0 +1,98 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dedupe
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCandidate(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	idx := NewIndex(4*24*time.Hour+time.Hour, []Tx{
+		{Date: day(1), Payee: "Shop", Account: "Expenses:Food", Amount: 10, Commodity: "EUR", Line: 1},
+		{Date: day(9), Payee: "Rent", Account: "Expenses:Rent", Amount: 10, Commodity: "USD", Line: 2},
+	})
+	for _, c := range []struct {
+		name      string
+		candidate Tx
+		want      []int
+	}{
+		{"same posting", Tx{Date: day(1), Account: "Expenses:Food", Amount: 10, Commodity: "EUR"}, []int{1}},
+		{"any account and commodity", Tx{Date: day(5), Amount: 10}, []int{1, 2}},
+		{"other account", Tx{Date: day(1), Account: "Assets:Bank", Amount: 10}, nil},
+		{"other commodity", Tx{Date: day(1), Amount: 10, Commodity: "USD"}, nil},
+		// Rounded down to 4 days
+		{"too late", Tx{Date: day(6), Account: "Expenses:Food", Amount: 10}, nil},
+		{"other amount", Tx{Date: day(1), Amount: 11}, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			v := CheckCandidate(idx, c.candidate)
+			var got []int
+			for _, tx := range v.Matches {
+				got = append(got, tx.Line)
+			}
+			if !reflect.DeepEqual(got, c.want) || v.Duplicate != (len(c.want) > 0) {
+				t.Errorf("got matches %v, duplicate %v, want %v", got, v.Duplicate, c.want)
+			}
+		})
+	}
+
+	samePayee := func(a, b *Tx) bool { return a.Payee == b.Payee }
+	if v := CheckCandidateMatching(idx, Tx{Date: day(6), Payee: "Rent", Amount: 10}, samePayee); len(v.Matches) != 1 || v.Matches[0].Line != 2 {
+		t.Errorf("got matches %v with the same payee, want line 2", v.Matches)
+	}
+
+	idx.Add(Tx{Date: day(20), Payee: "Shop", Amount: 10, Line: 3})
+	if v := CheckCandidate(idx, Tx{Date: day(21), Amount: 10}); len(v.Matches) != 1 || v.Matches[0].Line != 3 {
+		t.Errorf("got matches %v once added, want line 3", v.Matches)
+	}
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	idx := NewIndex(48*time.Hour, []Tx{
+		{Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Payee: "Shop", Account: "Expenses:Food", Amount: 10.1, Commodity: "EUR", File: "main.ledger", Line: 4},
+	})
+	var b bytes.Buffer
+	if _, err := idx.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadIndex(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.byAmount, idx.byAmount) || read.maxDuration != idx.maxDuration {
+		t.Errorf("got index %+v, want %+v", read.byAmount, idx.byAmount)
+	}
+
+	for _, c := range []struct {
+		index, err string
+	}{
+		{`{"version": 2, "max_duration": "48h0m0s", "postings": []}`, "index version 2"},
+		{`{"version": 1, "max_duration": "two days", "postings": []}`, "max_duration"},
+		{`[]`, "cannot unmarshal"},
+	} {
+		if _, err := ReadIndex(strings.NewReader(c.index)); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("read %v: got error %v, want %q", c.index, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dedupe
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Matcher tells whether a and b, two postings with the same amount (or
+// close ones, with -amount-tolerance), may be duplicates
+type Matcher func(a, b *Tx) bool
+
+// MatchOptions parameterizes matchers
+type MatchOptions struct {
+	// MaxDays is the largest number of days between two postings for window
+	MaxDays int
+	// PayeeSimilarity is the minimum similarity, between 0 and 1, of two
+	// payees for fuzzy-payee
+	PayeeSimilarity float64
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func(MatchOptions) Matcher{}
+)
+
+// RegisterMatcher makes a matching strategy available under name, for
+// NewMatcher and the -matchers flag of ledger-lint-duplicate. It panics if
+// name is already registered.
+func RegisterMatcher(name string, newMatcher func(MatchOptions) Matcher) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic("matcher registered twice: " + name)
+	}
+	registry[name] = newMatcher
+}
+
+func init() {
+	RegisterMatcher("exact", func(MatchOptions) Matcher {
+		return func(a, b *Tx) bool {
+			return a.Date.Equal(b.Date) && a.Payee == b.Payee
+		}
+	})
+	RegisterMatcher("window", func(o MatchOptions) Matcher {
+		return func(a, b *Tx) bool {
+			return daysApart(a.Date, b.Date) <= o.MaxDays
+		}
+	})
+	RegisterMatcher("fuzzy-payee", func(o MatchOptions) Matcher {
+		return func(a, b *Tx) bool {
+			return PayeeSimilarity(a.Payee, b.Payee) >= o.PayeeSimilarity
+		}
+	})
+	// FITID is the transaction identifier of OFX statements, that importers
+	// often keep in metadata
+	RegisterMatcher("fitid", func(MatchOptions) Matcher {
+		return func(a, b *Tx) bool {
+			fitid := a.Meta("fitid")
+			return fitid != "" && fitid == b.Meta("fitid")
+		}
+	})
+}
+
+// NewMatcher returns a matcher requiring all the registered matchers named
+// in names, separated by commas, to match
+func NewMatcher(names string, o MatchOptions) (Matcher, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	var all []Matcher
+	for _, name := range strings.Split(names, ",") {
+		newMatcher, exists := registry[strings.TrimSpace(name)]
+		if !exists {
+			return nil, fmt.Errorf("unknown matcher %q, available: %v", name, strings.Join(matcherNames(), ", "))
+		}
+		all = append(all, newMatcher(o))
+	}
+	return func(a, b *Tx) bool {
+		for _, m := range all {
+			if !m(a, b) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// MatcherNames returns the names of the registered matchers, sorted
+func MatcherNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return matcherNames()
+}
+
+func matcherNames() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PayeeSimilarity is the similarity of payees a and b, between 0 and 1,
+// ignoring case, as the larger of their similarity and the overlap of their
+// words. Bank exports add references and suffixes to the same payee, like
+// "AMAZON.COM*1234" and "AMAZON MKTPLACE", which share few of their
+// characters but a word.
+func PayeeSimilarity(a, b string) float64 {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	return math.Max(similarity(a, b), wordOverlap(a, b))
+}
+
+// payeeWord is a word of a payee, digits and punctuation being references
+var payeeWord = regexp.MustCompile(`\pL{3,}`)
+
+// wordOverlap is the number of words of a and b in common, over the number of
+// words of the one with fewer of them
+func wordOverlap(a, b string) float64 {
+	wordsA, wordsB := payeeWord.FindAllString(a, -1), payeeWord.FindAllString(b, -1)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+	inA := make(map[string]bool, len(wordsA))
+	for _, w := range wordsA {
+		inA[w] = true
+	}
+	common := 0
+	for _, w := range wordsB {
+		if inA[w] {
+			common++
+			delete(inA, w)
+		}
+	}
+	return float64(common) / float64(min(len(wordsA), len(wordsB)))
+}
+
+// similarity is 1 minus the Levenshtein distance of a and b, normalized by
+// the length of the longest
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
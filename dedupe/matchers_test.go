@@ -0,0 +1,111 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dedupe
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewMatcher(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	a := Tx{Date: day(1), Payee: "AMAZON.COM*1234", Metadata: map[string]string{"fitid": "42"}}
+	for _, c := range []struct {
+		names string
+		b     Tx
+		want  bool
+	}{
+		{"exact", Tx{Date: day(1), Payee: "AMAZON.COM*1234"}, true},
+		{"exact", Tx{Date: day(2), Payee: "AMAZON.COM*1234"}, false},
+		{"window", Tx{Date: day(4), Payee: "Other"}, true},
+		{"window", Tx{Date: day(5), Payee: "Other"}, false},
+		{"fuzzy-payee", Tx{Date: day(20), Payee: "Amazon Mktplace"}, true},
+		{"fuzzy-payee", Tx{Date: day(1), Payee: "Bakery"}, false},
+		{"fitid", Tx{Date: day(20), Metadata: map[string]string{"fitid": "42"}}, true},
+		{"fitid", Tx{Date: day(1), Payee: "AMAZON.COM*1234"}, false},
+		{"window, fuzzy-payee", Tx{Date: day(2), Payee: "amazon"}, true},
+		{"window, fuzzy-payee", Tx{Date: day(20), Payee: "amazon"}, false},
+	} {
+		t.Run(c.names+" "+c.b.Payee, func(t *testing.T) {
+			match, err := NewMatcher(c.names, MatchOptions{MaxDays: 3, PayeeSimilarity: 0.5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := match(&a, &c.b); got != c.want {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	if _, err := NewMatcher("window,nearby", MatchOptions{}); err == nil || !strings.Contains(err.Error(), `unknown matcher "nearby"`) {
+		t.Errorf("got error %v for an unknown matcher", err)
+	}
+}
+
+// registerOnce registers same-account, once for all runs of the tests
+var registerOnce sync.Once
+
+func TestRegisterMatcher(t *testing.T) {
+	registerOnce.Do(func() {
+		RegisterMatcher("same-account", func(MatchOptions) Matcher {
+			return func(a, b *Tx) bool { return a.Account == b.Account }
+		})
+	})
+	found := false
+	for _, name := range MatcherNames() {
+		found = found || name == "same-account"
+	}
+	if !found {
+		t.Errorf("same-account is not in %v", MatcherNames())
+	}
+	match, err := NewMatcher("same-account", MatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match(&Tx{Account: "Assets:Bank"}, &Tx{Account: "Assets:Bank"}) || match(&Tx{Account: "Assets:Bank"}, &Tx{Account: "Expenses"}) {
+		t.Error("the registered matcher is not used")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice does not panic")
+		}
+	}()
+	RegisterMatcher("exact", func(MatchOptions) Matcher { return nil })
+}
+
+func TestPayeeSimilarity(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want float64
+	}{
+		{"Shop", "shop", 1},
+		{"", "", 1},
+		{"abcd", "abcx", 0.75},
+		// One word of two in common
+		{"AMAZON.COM*1234", "AMAZON MKTPLACE", 0.5},
+		{"abc", "xyz", 0},
+	} {
+		if got := PayeeSimilarity(c.a, c.b); got != c.want {
+			t.Errorf("similarity of %q and %q: got %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
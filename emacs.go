@@ -0,0 +1,232 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// sexp is either a string, a symbol (as a *string), an int64 or a []sexp
+type sexp interface{}
+
+// emacsStates are the states of postings by their symbol
+var emacsStates = map[string]string{"t": "cleared", "pending": "pending"}
+
+type sexpParser struct {
+	s   string
+	pos int
+}
+
+func (p *sexpParser) skipSpace() {
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == ';' {
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+		} else if unicode.IsSpace(rune(c)) {
+			p.pos++
+		} else {
+			return
+		}
+	}
+}
+
+func (p *sexpParser) parse() (sexp, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, fmt.Errorf("unexpected end of input at offset %d", p.pos)
+	}
+	switch p.s[p.pos] {
+	case '(':
+		p.pos++
+		list := []sexp{}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.s) {
+				return nil, fmt.Errorf("unterminated list at offset %d", p.pos)
+			}
+			if p.s[p.pos] == ')' {
+				p.pos++
+				return list, nil
+			}
+			e, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, e)
+		}
+	case ')':
+		return nil, fmt.Errorf("unexpected ) at offset %d", p.pos)
+	case '"':
+		p.pos++
+		var b strings.Builder
+		for p.pos < len(p.s) {
+			c := p.s[p.pos]
+			p.pos++
+			switch c {
+			case '\\':
+				if p.pos < len(p.s) {
+					b.WriteByte(p.s[p.pos])
+					p.pos++
+				}
+			case '"':
+				return b.String(), nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return nil, fmt.Errorf("unterminated string at offset %d", p.pos)
+	default:
+		start := p.pos
+		for p.pos < len(p.s) && !unicode.IsSpace(rune(p.s[p.pos])) && p.s[p.pos] != '(' && p.s[p.pos] != ')' {
+			p.pos++
+		}
+		atom := p.s[start:p.pos]
+		if n, err := strconv.ParseInt(atom, 10, 64); err == nil {
+			return n, nil
+		}
+		return &atom, nil
+	}
+}
+
+// parseEmacs reads the output of `ledger emacs`: a list of transactions of
+// the form
+//
+//	("file" line (time-high time-low 0) code payee
+//	  (line "account" "amount" state [cost] [note])...)
+func parseEmacs(fileName string, b []byte) (map[amountKey][]Tx, error) {
+	p := sexpParser{s: string(b)}
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", fileName, err)
+	}
+	xacts, ok := root.([]sexp)
+	if !ok {
+		return nil, fmt.Errorf("%v: expected a list of transactions", fileName)
+	}
+
+	txs := make(map[amountKey][]Tx)
+	for position, x := range xacts {
+		xact, ok := x.([]sexp)
+		if !ok || len(xact) < 5 {
+			return nil, fmt.Errorf("%v: malformed transaction %d", fileName, position)
+		}
+		file, _ := xact[0].(string)
+		line, _ := xact[1].(int64)
+		date, err := emacsDate(xact[2])
+		if err != nil {
+			return nil, fmt.Errorf("%v: transaction %d: %w", fileName, position, err)
+		}
+		payee, _ := xact[4].(string)
+
+		for _, pst := range xact[5:] {
+			post, ok := pst.([]sexp)
+			if !ok || len(post) < 3 {
+				return nil, fmt.Errorf("%v: malformed posting in transaction %d", fileName, position)
+			}
+			postLine, _ := post[0].(int64)
+			account, _ := post[1].(string)
+			amountStr, _ := post[2].(string)
+			amount, commodity, err := parseDecimal(amountStr)
+			if err != nil {
+				return nil, fmt.Errorf("%v:%v: %w", file, postLine, err)
+			}
+
+			// The note, if any, is the last element. Only posting tags
+			// are available from there, transaction notes are not exported.
+			var tags []string
+			var note string
+			if len(post) > 4 {
+				note, _ = post[len(post)-1].(string)
+				tags = noteTags(note)
+			}
+
+			// The state follows the amount as the symbol t, pending or nil.
+			var state string
+			if len(post) > 3 {
+				if symbol, ok := post[3].(*string); ok {
+					state = emacsStates[*symbol]
+				}
+			}
+
+			if postLine <= 0 {
+				postLine = line
+			}
+			tx := Tx{
+				Tx: dedupe.Tx{
+					Date:      date,
+					File:      file,
+					Line:      int(postLine),
+					Payee:     payee,
+					Account:   account,
+					Commodity: commodity,
+				},
+				Position:    position,
+				HeaderLine:  int(line),
+				PostingTags: tags,
+				State:       state,
+				Note:        note,
+			}
+			tx.setQuantity(amount)
+			if reason := skipped(&tx); reason != "" {
+				audit(reason, &tx)
+				continue
+			}
+			txs[tx.key()] = append(txs[tx.key()], tx)
+		}
+	}
+	return txs, nil
+}
+
+// emacsDate converts an emacs time triplet, in local time, to a date
+func emacsDate(e sexp) (time.Time, error) {
+	t, ok := e.([]sexp)
+	if !ok || len(t) < 2 {
+		return time.Time{}, fmt.Errorf("malformed date %v", e)
+	}
+	high, ok1 := t[0].(int64)
+	low, ok2 := t[1].(int64)
+	if !ok1 || !ok2 {
+		return time.Time{}, fmt.Errorf("malformed date %v", e)
+	}
+	y, m, d := time.Unix(high*65536+low, 0).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+}
+
+// noteTags returns the tags of a note like ":tag1:tag2:"
+func noteTags(note string) (tags []string) {
+	for _, field := range strings.Fields(note) {
+		if len(field) < 3 || field[0] != ':' || field[len(field)-1] != ':' {
+			continue
+		}
+		for _, tag := range strings.Split(field[1:len(field)-1], ":") {
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,68 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEmacs(t *testing.T) {
+	// 2024-03-01 at noon UTC, the same day in most time zones
+	const date = "(26081 49984 0)"
+	for _, c := range []struct {
+		name  string
+		emacs string
+		want  []string
+		err   string
+	}{
+		{"postings", `(("main.ledger" 3 ` + date + ` nil "Shop"
+  (4 "Expenses:Food" "10.50 EUR" t)
+  (5 "Assets:Bank" "-10.50 EUR" pending "(10.50 EUR)" ":notDup:"))
+)`, []string{
+			"main.ledger:4 2024-03-01 cleared Shop Expenses:Food 10.5 EUR []",
+			"main.ledger:5 2024-03-01 pending Shop Assets:Bank -10.5 EUR [notDup]",
+		}, ""},
+		{"posting without line", `(("main.ledger" 3 ` + date + ` "42" "Shop \"Deli\""
+  (0 "Assets:Bank" "$-3" nil))
+)`, []string{
+			`main.ledger:3 2024-03-01  Shop "Deli" Assets:Bank -3 $ []`,
+		}, ""},
+		{"not a list", `"main.ledger"`, nil, "expected a list of transactions"},
+		{"unterminated", `(("main.ledger" 3 ` + date, nil, "unterminated list"},
+		{"malformed date", `(("main.ledger" 3 (1) nil "Shop" (4 "Expenses:Food" "1 EUR" nil)))`, nil, "transaction 0: malformed date"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			txs, err := parseEmacs("main.el", []byte(c.emacs))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describePostings(txs); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got postings\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(c.want, "\n"))
+			}
+		})
+	}
+}
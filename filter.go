@@ -0,0 +1,121 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// An accountFilter is a regexp flag matching the start of account names
+type accountFilter struct {
+	*regexp.Regexp
+}
+
+func (f *accountFilter) String() string {
+	if f.Regexp == nil {
+		return ""
+	}
+	return f.Regexp.String()[len("^(?:") : len(f.Regexp.String())-1]
+}
+
+func (f *accountFilter) Set(value string) error {
+	re, err := regexp.Compile("^(?:" + value + ")")
+	if err != nil {
+		return err
+	}
+	f.Regexp = re
+	return nil
+}
+
+func (f *accountFilter) reset() {
+	f.Regexp = nil
+}
+
+var onlyAccounts, excludedAccounts accountFilter
+
+func init() {
+	flag.Var(&onlyAccounts, "account", "only read postings to accounts starting with this `regexp`, like Expenses:")
+	flag.Var(&excludedAccounts, "exclude-account", "skip postings to accounts starting with this `regexp`, like Assets:Brokerage")
+}
+
+// A dateFlag is a date flag, given as a day like 2024-03-01, a month like
+// 2024-03 or a year like 2024, with - or / between parts, like ledger does
+type dateFlag struct {
+	time.Time
+}
+
+func (f *dateFlag) String() string {
+	if f.IsZero() {
+		return ""
+	}
+	return f.Format("2006-01-02")
+}
+
+func (f *dateFlag) Set(value string) error {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, strings.ReplaceAll(value, "/", "-")); err == nil {
+			f.Time = t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid date %q, expected one like 2024-03-01, 2024-03 or 2024", value)
+}
+
+func (f *dateFlag) reset() {
+	f.Time = time.Time{}
+}
+
+var begin, end dateFlag
+
+func init() {
+	flag.Var(&begin, "begin", "only read transactions on or after this `date`, like 2024-03-01 or 2024, like ledger -b")
+	flag.Var(&end, "end", "only read transactions before this `date`, like 2024-04-01 or 2025, like ledger -e")
+}
+
+var minAmount = flag.Float64("min-amount", 0, "skip postings whose amount, whatever its sign, is below this `amount`, like 0.01 to skip those of 0.00")
+
+// skipped returns why tx is not read, with -account, -exclude-account,
+// -begin, -end, -min-amount and the rules of the ignore file, or an empty
+// string
+func skipped(tx *Tx) string {
+	if onlyAccounts.Regexp != nil && !onlyAccounts.MatchString(tx.Account) {
+		return "account filtered out by -account"
+	}
+	if excludedAccounts.Regexp != nil && excludedAccounts.MatchString(tx.Account) {
+		return "account filtered out by -exclude-account"
+	}
+	if !begin.IsZero() && tx.Date.Before(begin.Time) {
+		return "date before -begin"
+	}
+	if !end.IsZero() && !tx.Date.Before(end.Time) {
+		return "date not before -end"
+	}
+	if math.Abs(tx.Amount) < *minAmount {
+		return "amount below -min-amount"
+	}
+	if line, ignored := ruleIgnored(tx); ignored {
+		return fmt.Sprintf("rule on line %v of the ignore file", line)
+	}
+	return ""
+}
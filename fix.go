@@ -0,0 +1,545 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var fix = flag.String("fix", "", "with merge, offer to merge each group of duplicates into its first transaction, rewriting the journals; with remove, write the journal without high-confidence duplicates to -output")
+
+// reviewedKey is the metadata key marking transactions reviewed as not
+// duplicates
+const reviewedKey = "dedup-reviewed"
+
+var backupDir = flag.String("backup-dir", "", "`directory` of the backups of journals written before rewriting them, by default that of each journal")
+var fixBranch = flag.String("fix-branch", "", "with -fix merge, apply fixes on this new git `branch`, one commit per group, instead of backing up journals")
+var output = flag.String("output", "", "with -fix remove, `file` to write the cleaned journal to")
+
+// locateTxs sets the journal file and line of the transactions of in, read
+// from `ledger emacs`, which, unlike `ledger xml`, has them. Transactions are
+// in the same order in both exports. Inputs read by other parsers, like CSV
+// or Beancount files, are located already.
+func locateTxs(in *input, ledgerArgs string) error {
+	if in.err != nil || in.txs == nil || located(in.txs) {
+		return nil
+	}
+	b, err := ioutil.ReadFile(in.fileName)
+	if err != nil {
+		return err
+	}
+	switch content := strings.TrimSpace(string(b)); {
+	case strings.HasPrefix(content, "(") || nativeParser():
+		// Already located
+		return nil
+	case strings.HasPrefix(content, "<"):
+		return fmt.Errorf("%v: transactions from XML cannot be located in the journal, give the journal instead", in.fileName)
+	}
+
+	b, err = export(in.fileName, ledgerArgs, "emacs")
+	if err != nil {
+		return err
+	}
+	located, err := parseEmacs(in.fileName, b)
+	if err != nil {
+		return err
+	}
+	locations := make(map[int]*Tx)
+	for _, bucket := range located {
+		for i := range bucket {
+			locations[bucket[i].Position] = &bucket[i]
+		}
+	}
+	for _, bucket := range in.txs {
+		for i := range bucket {
+			if l, exists := locations[bucket[i].Position]; exists {
+				bucket[i].File, bucket[i].Line, bucket[i].HeaderLine = l.File, l.Line, l.HeaderLine
+			}
+		}
+	}
+	return nil
+}
+
+// located tells whether all postings of txs have their file and line
+func located(txs map[amountKey][]Tx) bool {
+	for _, bucket := range txs {
+		for _, tx := range bucket {
+			if tx.File == "" || tx.Line == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// A location of a transaction in a journal, by the line of its header
+type location struct {
+	file string
+	line int
+}
+
+func (l location) String() string {
+	return fmt.Sprintf("%v:%v", l.file, l.line)
+}
+
+// A merge of the transactions at remove into the one at keep, adding comments
+// to it
+type merge struct {
+	keep        location
+	remove      []location
+	comments    []string
+	title       string
+	fingerprint string
+}
+
+// journals holds the lines of the journals to fix, by file name
+type journals map[string][]string
+
+func (j journals) lines(file string) ([]string, error) {
+	if lines, exists := j[file]; exists {
+		return lines, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	j[file] = strings.Split(string(b), "\n")
+	return j[file], nil
+}
+
+// transaction returns the location of the transaction with a line at line,
+// and the index of its first line and of the line after it. Transactions
+// start with an unindented line and go on with indented ones.
+func (j journals) transaction(file string, line int) (l location, start, end int, err error) {
+	lines, err := j.lines(file)
+	if err != nil {
+		return l, 0, 0, err
+	}
+	if line < 1 || line > len(lines) {
+		return l, 0, 0, fmt.Errorf("%v:%v: no such line", file, line)
+	}
+	indented := func(s string) bool {
+		return strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\t")
+	}
+	for start = line - 1; start > 0 && indented(lines[start]); start-- {
+	}
+	for end = start + 1; end < len(lines) && indented(lines[end]) && strings.TrimSpace(lines[end]) != ""; end++ {
+	}
+	return location{file, start + 1}, start, end, nil
+}
+
+// comments returns the transaction comments of the transaction from start to
+// end, as indented comment lines
+func comments(lines []string, start, end int) (c []string) {
+	if i := strings.Index(lines[start], ";"); i >= 0 {
+		c = append(c, "    "+strings.TrimSpace(lines[start][i:]))
+	}
+	for _, line := range lines[start+1 : end] {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, ";") {
+			// Postings start, with their own comments
+			break
+		}
+		c = append(c, "    "+trimmed)
+	}
+	return c
+}
+
+// planMerges returns a merge for each group of duplicates, keeping its first
+// transaction. Postings with ignoredTag are left out, as are groups with
+// transactions already in a previous merge.
+func planMerges(j journals, ignoredTag string, duplicates [][]*Tx) ([]merge, error) {
+	var merges []merge
+	seen := make(map[location]bool)
+	for _, group := range duplicates {
+		var m merge
+		var locations []location
+		var keepLines []string
+		var keepStart, keepEnd int
+		for _, tx := range group {
+			if find(ignoredTag, tx.Tags) {
+				continue
+			}
+			if tx.File == "" {
+				return nil, fmt.Errorf("transaction %v of %v has no location in a journal", tx.Position, tx.Payee)
+			}
+			l, start, end, err := j.transaction(tx.File, tx.Line)
+			if err != nil {
+				return nil, err
+			}
+			if len(locations) > 0 && (l == locations[0] || containsLocation(m.remove, l)) {
+				continue
+			}
+			locations = append(locations, l)
+			if len(locations) == 1 {
+				m.keep = l
+				m.title = fmt.Sprintf("%v %v", tx.Date.Format("2006-01-02"), tx.Payee)
+				keepLines, keepStart, keepEnd = j[l.file], start, end
+				continue
+			}
+			m.remove = append(m.remove, l)
+			existing := comments(keepLines, keepStart, keepEnd)
+			for _, c := range comments(j[l.file], start, end) {
+				if !containsString(existing, c) && !containsString(m.comments, c) {
+					m.comments = append(m.comments, c)
+				}
+			}
+		}
+		if len(m.remove) == 0 {
+			continue
+		}
+		m.fingerprint = fingerprint(group...)
+		conflict := false
+		for _, l := range locations {
+			conflict = conflict || seen[l]
+		}
+		if conflict {
+			continue
+		}
+		for _, l := range locations {
+			seen[l] = true
+		}
+		merges = append(merges, m)
+	}
+	return merges, nil
+}
+
+func containsLocation(locations []location, l location) bool {
+	for _, other := range locations {
+		if other == l {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(s []string, e string) bool {
+	for _, other := range s {
+		if other == e {
+			return true
+		}
+	}
+	return false
+}
+
+// fixMerge shows the merge of each group of duplicates, asking on in whether
+// to apply it, and rewrites the journals with the accepted merges. Groups
+// reviewed as legitimate instead get reviewedKey metadata, for later scans to
+// skip them. It returns the number of merges applied.
+func fixMerge(ignoredTag string, duplicates [][]*Tx, in io.Reader) (int, error) {
+	j := make(journals)
+	merges, err := planMerges(j, ignoredTag, duplicates)
+	if err != nil {
+		return 0, err
+	}
+
+	answers := bufio.NewScanner(in)
+	var accepted []merge
+	var reviewed []merge
+	for _, m := range merges {
+		fmt.Printf("; Merge into %v %v:\n", m.keep, m.title)
+		for _, l := range m.remove {
+			fmt.Printf("-\t%v\t%v\n", l, strings.TrimSpace(j[l.file][l.line-1]))
+		}
+		for _, c := range m.comments {
+			fmt.Printf("+\t%v\n", strings.TrimSpace(c))
+		}
+		fmt.Print("Merge? [y/N/r(eviewed, not duplicates)/q] ")
+		if !answers.Scan() {
+			fmt.Println()
+			break
+		}
+		answer := strings.ToLower(strings.TrimSpace(answers.Text()))
+		if answer == "q" {
+			break
+		}
+		switch answer {
+		case "y":
+			accepted = append(accepted, m)
+		case "r":
+			reviewed = append(reviewed, m)
+		}
+	}
+	if err := answers.Err(); err != nil {
+		return 0, err
+	}
+
+	// One step per group, for commits on a fix branch
+	steps := make([][]merge, 0, len(accepted)+len(reviewed))
+	for _, m := range accepted {
+		steps = append(steps, []merge{m})
+	}
+	comment := fmt.Sprintf("    ; %v: %v", reviewedKey, time.Now().Format("2006-01-02"))
+	for _, m := range reviewed {
+		step := []merge{{keep: m.keep, comments: []string{comment}, title: m.title, fingerprint: m.fingerprint}}
+		for _, l := range m.remove {
+			step = append(step, merge{keep: l, comments: []string{comment}})
+		}
+		steps = append(steps, step)
+	}
+	if *fixBranch != "" {
+		return len(accepted), commitSteps(j, steps, *fixBranch)
+	}
+
+	var edits []merge
+	for _, step := range steps {
+		edits = append(edits, step...)
+	}
+	edited, err := editJournals(j, edits, false)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	for file, lines := range edited {
+		if err := backup(file, *backupDir, now); err != nil {
+			return 0, err
+		}
+		if err := writeFile(file, []byte(strings.Join(lines, "\n"))); err != nil {
+			return 0, err
+		}
+	}
+	return len(accepted), nil
+}
+
+// editJournals returns the lines of the journals of j changed by merges. With
+// note, removed transactions are replaced by a comment instead of dropped.
+func editJournals(j journals, merges []merge, note bool) (map[string][]string, error) {
+	// Edits by file, as the index of the line to remove or insert after,
+	// applied from the end for indexes to stay valid
+	type edit struct {
+		index  int
+		remove int
+		insert []string
+	}
+	edits := make(map[string][]edit)
+	for _, m := range merges {
+		if len(m.comments) > 0 {
+			// Comments go after those of the kept transaction
+			_, index, end, err := j.transaction(m.keep.file, m.keep.line)
+			if err != nil {
+				return nil, err
+			}
+			for index++; index < end && strings.HasPrefix(strings.TrimSpace(j[m.keep.file][index]), ";"); index++ {
+			}
+			edits[m.keep.file] = append(edits[m.keep.file], edit{index: index, insert: m.comments})
+		}
+		for _, l := range m.remove {
+			_, start, end, err := j.transaction(l.file, l.line)
+			if err != nil {
+				return nil, err
+			}
+			e := edit{index: start}
+			if note {
+				e.insert = []string{fmt.Sprintf("; ledger-lint-duplicate: removed %q, duplicate of %v", strings.TrimSpace(j[l.file][start]), m.keep)}
+			} else if end < len(j[l.file]) && strings.TrimSpace(j[l.file][end]) == "" {
+				// Along with the blank line separating it from the next one
+				end++
+			}
+			e.remove = end - start
+			edits[l.file] = append(edits[l.file], e)
+		}
+	}
+
+	edited := make(map[string][]string)
+	for file, fileEdits := range edits {
+		sort.SliceStable(fileEdits, func(a, b int) bool {
+			return fileEdits[a].index > fileEdits[b].index
+		})
+		lines := append([]string(nil), j[file]...)
+		for _, e := range fileEdits {
+			rest := append(append([]string(nil), e.insert...), lines[e.index+e.remove:]...)
+			lines = append(lines[:e.index], rest...)
+		}
+		edited[file] = lines
+	}
+	return edited, nil
+}
+
+// fixRemove writes to output the journal with the high-confidence duplicates
+// removed: those on the same day and with the same payee as the first
+// transaction of their group, or with a time of day at most timeWindow from
+// its own. They must all be in the first of inputs, not in included files.
+// output cannot be one of the journals read.
+func fixRemove(ignoredTag string, timeWindow time.Duration, duplicates [][]*Tx, inputs []string, output string) (int, error) {
+	journal := inputs[0]
+	read := append([]string(nil), inputs...)
+	for _, group := range duplicates {
+		for _, tx := range group {
+			read = append(read, tx.File)
+		}
+	}
+	if err := checkNotInput(output, read); err != nil {
+		return 0, err
+	}
+
+	var sure [][]*Tx
+	for _, group := range duplicates {
+		same := []*Tx{group[0]}
+		for _, tx := range group[1:] {
+			d, timed := timeApart(group[0], tx)
+			if tx.Date.Equal(group[0].Date) && strings.EqualFold(tx.Payee, group[0].Payee) || timeWindow > 0 && timed && d <= timeWindow {
+				same = append(same, tx)
+			}
+		}
+		sure = append(sure, same)
+	}
+
+	j := make(journals)
+	merges, err := planMerges(j, ignoredTag, sure)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for i := range merges {
+		merges[i].comments = nil
+		removed += len(merges[i].remove)
+	}
+	edited, err := editJournals(j, merges, true)
+	if err != nil {
+		return 0, err
+	}
+
+	journalInfo, err := os.Stat(journal)
+	if err != nil {
+		return 0, err
+	}
+	lines, err := j.lines(journal)
+	if err != nil {
+		return 0, err
+	}
+	for file, fileLines := range edited {
+		info, err := os.Stat(file)
+		if err != nil {
+			return 0, err
+		}
+		if !os.SameFile(info, journalInfo) {
+			return 0, fmt.Errorf("%v: duplicates to remove are in an included journal, give it instead", file)
+		}
+		lines = fileLines
+	}
+	return removed, ioutil.WriteFile(output, []byte(strings.Join(lines, "\n")), journalInfo.Mode().Perm())
+}
+
+// checkNotInput returns an error if output is one of inputs, that it would
+// overwrite
+func checkNotInput(output string, inputs []string) error {
+	outputInfo, err := os.Stat(output)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, input := range inputs {
+		if info, err := os.Stat(input); err == nil && os.SameFile(info, outputInfo) {
+			return fmt.Errorf("%v is the journal %v, give another -output", output, input)
+		}
+	}
+	return nil
+}
+
+// backup copies file to dir, or to the directory of file if dir is empty, as
+// file.<time>.bak. In dir, file keeps its path relative to the current
+// directory, or its absolute path outside of it, for journals with the same
+// name in different directories not to share backups. An existing backup is
+// never overwritten, a number being added to the name instead.
+func backup(file, dir string, t time.Time) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	name := file
+	if dir != "" {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(wd, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			rel = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+		}
+		name = filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(name), 0o777); err != nil {
+			return err
+		}
+	}
+	name = fmt.Sprintf("%v.%v", name, t.Format("20060102T150405"))
+	for i := 1; ; i++ {
+		candidate := name + ".bak"
+		if i > 1 {
+			candidate = fmt.Sprintf("%v.%v.bak", name, i)
+		}
+		f, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("backing up %v: %w", file, err)
+		}
+		if _, err := f.Write(b); err != nil {
+			f.Close()
+			return fmt.Errorf("backing up %v: %w", file, err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("backing up %v: %w", file, err)
+		}
+		slog.Info("backed up journal", "file", file, "backup", candidate)
+		return nil
+	}
+}
+
+// writeFile replaces file with b, through a temporary file for it to never
+// be partially written
+func writeFile(file string, b []byte) error {
+	var mode os.FileMode = 0o644
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,218 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chdir changes the current directory to dir for the rest of the test
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestBackup(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		name  string
+		files []string
+		dir   string
+		want  []string
+	}{
+		{"next to the journal", []string{"2021/bank.ledger"}, "", []string{"2021/bank.ledger.20240301T120000.bak"}},
+		{"same name in backup dir", []string{"2021/bank.ledger", "2022/bank.ledger"}, "backups", []string{
+			"backups/2021/bank.ledger.20240301T120000.bak",
+			"backups/2022/bank.ledger.20240301T120000.bak",
+		}},
+		{"same second", []string{"2021/bank.ledger", "2021/bank.ledger"}, "", []string{
+			"2021/bank.ledger.20240301T120000.2.bak",
+			"2021/bank.ledger.20240301T120000.bak",
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			for _, file := range c.files {
+				os.MkdirAll(filepath.Dir(file), 0o777)
+				if err := os.WriteFile(file, []byte(file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := backup(file, c.dir, now); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, _ := filepath.Glob(filepath.Join("*", "*.bak"))
+			more, _ := filepath.Glob(filepath.Join("*", "*", "*.bak"))
+			got = append(got, more...)
+			sort.Strings(got)
+			if len(got) != len(c.want) {
+				t.Fatalf("got backups %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if filepath.ToSlash(got[i]) != c.want[i] {
+					t.Errorf("got backups %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+// journalGroup writes journal to main.ledger in the current directory and
+// returns its postings to account, as a group of duplicates
+func journalGroup(t *testing.T, journal, account string) []*Tx {
+	if err := os.WriteFile("main.ledger", []byte(journal), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	txs, err := parseJournal("main.ledger", []byte(journal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var group []*Tx
+	for _, bucket := range txs {
+		for i := range bucket {
+			if bucket[i].Account == account {
+				group = append(group, &bucket[i])
+			}
+		}
+	}
+	sort.Slice(group, func(i, j int) bool { return group[i].Line < group[j].Line })
+	return group
+}
+
+func TestFixMerge(t *testing.T) {
+	const journal = `2024/03/01 Shop  ; :food:
+    ; id: 1
+    Expenses:Food  10 EUR
+    Assets:Bank
+
+2024/03/02 Shop
+    ; id: 2
+    Expenses:Food  10 EUR
+    Assets:Bank
+
+2024/03/10 Rent
+    Expenses:Rent  500 EUR
+    Assets:Bank
+
+2024/03/11 Rent
+    Expenses:Rent  500 EUR
+    Assets:Bank
+`
+	reviewed := "    ; " + reviewedKey + ": " + time.Now().Format("2006-01-02")
+	for _, c := range []struct {
+		name    string
+		answers string
+		merged  int
+		want    string
+	}{
+		{"merge and review", "y\nr\n", 1, `2024/03/01 Shop  ; :food:
+    ; id: 1
+    ; id: 2
+    Expenses:Food  10 EUR
+    Assets:Bank
+
+2024/03/10 Rent
+` + reviewed + `
+    Expenses:Rent  500 EUR
+    Assets:Bank
+
+2024/03/11 Rent
+` + reviewed + `
+    Expenses:Rent  500 EUR
+    Assets:Bank
+`},
+		{"refuse", "n\n", 0, journal},
+		{"quit", "q\ny\n", 0, journal},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			food := journalGroup(t, journal, "Expenses:Food")
+			rent := journalGroup(t, journal, "Expenses:Rent")
+			merged, err := fixMerge("notDup", [][]*Tx{food, rent}, strings.NewReader(c.answers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if merged != c.merged {
+				t.Errorf("got %v merges, want %v", merged, c.merged)
+			}
+			got, err := os.ReadFile("main.ledger")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.want {
+				t.Errorf("got journal\n%s\nwant\n%s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFixRemove(t *testing.T) {
+	chdir(t, t.TempDir())
+	group := journalGroup(t, `2024/03/01 Shop
+    Expenses:Food  10 EUR
+    Assets:Bank
+
+2024/03/01 shop
+    Expenses:Food  10 EUR
+    Assets:Bank
+
+2024/03/03 Shop
+    Expenses:Food  10 EUR
+    Assets:Bank
+`, "Expenses:Food")
+	if _, err := fixRemove("notDup", 0, [][]*Tx{group}, []string{"main.ledger"}, "main.ledger"); err == nil {
+		t.Error("the journal was overwritten")
+	}
+	removed, err := fixRemove("notDup", 0, [][]*Tx{group}, []string{"main.ledger"}, "clean.ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("got %v removed, want 1", removed)
+	}
+	got, err := os.ReadFile("clean.ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the transaction on the same day is sure to be a duplicate
+	want := `2024/03/01 Shop
+    Expenses:Food  10 EUR
+    Assets:Bank
+
+; ledger-lint-duplicate: removed "2024/03/01 shop", duplicate of main.ledger:1
+
+2024/03/03 Shop
+    Expenses:Food  10 EUR
+    Assets:Bank
+`
+	if string(got) != want {
+		t.Errorf("got journal\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// journalFixtures are the journals of the golden tests, seeding the fuzz
+// targets
+var journalFixtures = []string{"test.ledger", "test-2021.ledger", "test-2022.ledger"}
+
+// xmlSeed is a minimal `ledger xml` export, with an account declared by ref
+const xmlSeed = `<?xml version="1.0" encoding="utf-8"?>
+<ledger version="197120">
+<accounts><account id="1"><name>Expenses</name><fullname>Expenses</fullname>
+<account id="2"><name>A</name><fullname>Expenses:A</fullname></account></account></accounts>
+<transactions>
+<transaction state="cleared"><date>2021/05/01</date><payee>Dup4</payee>
+<metadata><tag>notDup</tag><value key="Group"><string>7a2491e65e573393</string></value></metadata>
+<postings><posting><account ref="2"><name>A</name></account>
+<post-amount><amount><commodity><symbol>£</symbol></commodity><quantity>10.00</quantity></amount></post-amount>
+</posting></postings></transaction>
+</transactions>
+</ledger>
+`
+
+// emacsSeed is a `ledger emacs` export of the first transactions of
+// test.ledger
+const emacsSeed = `(("test.ledger" 1 (24717 36224 0) nil "Dup4"
+  (3 "Expenses:A" "10,00 £" nil)
+  (4 "Assets:A" "-10,00 £" nil))
+ ("test.ledger" 6 (24720 27136 0) nil "Dup4"
+  (9 "Expenses:A" "10,00 £" t " :notDup:")
+  (10 "Assets:A" "-10,00 £" pending)))
+`
+
+// addFixtures adds the journal fixtures to the corpus of f
+func addFixtures(f *testing.F) {
+	for _, name := range journalFixtures {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+}
+
+// checkKeys fails t if a posting of txs is not in the bucket of its amount
+func checkKeys(t *testing.T, txs map[amountKey][]Tx) {
+	for k, bucket := range txs {
+		for _, tx := range bucket {
+			if tx.key() != k {
+				t.Errorf("posting of %v in the bucket of %v", tx.key(), k)
+			}
+		}
+	}
+}
+
+func FuzzParseAmount(f *testing.F) {
+	for _, seed := range []string{"10,00 £", "-10,00 EUR", "£10.00", "1,234.5 \"ABC 1\"", "10 AAPL @ $50", "0.1", "-0"} {
+		f.Add(seed)
+	}
+	for _, name := range journalFixtures {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if fields := strings.Fields(stripComment(line)); len(fields) > 1 && strings.HasPrefix(line, " ") {
+				f.Add(strings.Join(fields[1:], " "))
+			}
+		}
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		q, _, err := parseDecimal(s)
+		if err != nil {
+			return
+		}
+		// The canonical decimal is exact
+		back, ok := new(big.Rat).SetString(decimalString(q))
+		if !ok || back.Cmp(q) != 0 {
+			t.Errorf("decimalString(%v) = %v", q, decimalString(q))
+		}
+		if _, _, err := parseAmount(s); err != nil {
+			t.Errorf("parseAmount(%q) failed where parseDecimal did not: %v", s, err)
+		}
+	})
+}
+
+func FuzzParseEmacs(f *testing.F) {
+	f.Add([]byte(emacsSeed))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		txs, err := parseEmacs("fuzz", b)
+		if err == nil {
+			checkKeys(t, txs)
+		}
+	})
+}
+
+func FuzzDecodeLedger(f *testing.F) {
+	f.Add([]byte(xmlSeed))
+	// Seed inputs of `fuzz-corpus export`, with its default directory
+	seeds, _ := filepath.Glob(filepath.Join("corpus", "*.xml"))
+	for _, name := range seeds {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, lenient := range []bool{false, true} {
+			ledger, _, err := decodeLedger(b, lenient)
+			if err != nil {
+				continue
+			}
+			txs, _ := ledger.toTxs(ledger.accountNames())
+			checkKeys(t, txs)
+		}
+	})
+}
+
+func FuzzParseJournal(f *testing.F) {
+	addFixtures(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// Included files are read from disk, possibly blocking, like
+		// /dev/stdin
+		if strings.Contains(string(b), "include") {
+			t.Skip()
+		}
+		txs, err := parseJournal(filepath.Join(t.TempDir(), "fuzz.ledger"), b)
+		if err == nil {
+			checkKeys(t, txs)
+		}
+	})
+}
@@ -0,0 +1,262 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// anonymizer replaces names and amounts consistently within a run: the same
+// payee always gets the same replacement, so that duplicates stay duplicates,
+// but replacements differ from one run to the next
+type anonymizer struct {
+	salt [32]byte
+	// years is how much dates are shifted, a multiple of 4 for leap years,
+	// and so the days between dates, to stay the same
+	years int
+	// offset is added to amounts
+	offset int64
+	// letters and digits encipher payees
+	letters [26]rune
+	digits  [10]rune
+}
+
+func newAnonymizer() (*anonymizer, error) {
+	var a anonymizer
+	if _, err := rand.Read(a.salt[:]); err != nil {
+		return nil, err
+	}
+	a.years = 4 * (1 + int(a.salt[0]%10))
+	if a.salt[1]%2 == 0 {
+		a.years = -a.years
+	}
+	a.offset = 100 + int64(binary.BigEndian.Uint16(a.salt[2:4])%9900)
+	shuffle := mathrand.New(mathrand.NewSource(int64(binary.BigEndian.Uint64(a.salt[4:12]))))
+	for i, p := range shuffle.Perm(len(a.letters)) {
+		a.letters[i] = 'a' + rune(p)
+	}
+	for i, p := range shuffle.Perm(len(a.digits)) {
+		a.digits[i] = '0' + rune(p)
+	}
+	return &a, nil
+}
+
+func (a *anonymizer) hash(s string) []byte {
+	h := sha256.New()
+	h.Write(a.salt[:])
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// text replaces s by a short hash, keeping empty strings empty
+func (a *anonymizer) text(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return s
+	}
+	return "x" + hex.EncodeToString(a.hash(s))[:8]
+}
+
+// account replaces each segment of an account name, preserving the hierarchy
+func (a *anonymizer) account(s string) string {
+	segments := strings.Split(s, ":")
+	for i := range segments {
+		segments[i] = a.text(strings.Join(segments[:i+1], ":"))
+	}
+	return strings.Join(segments, ":")
+}
+
+// payee replaces each ASCII letter and digit of s by another, always the
+// same, keeping the case, for payees to be as similar as they were. Other
+// characters are kept.
+func (a *anonymizer) payee(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return a.letters[r-'a']
+		case r >= 'A' && r <= 'Z':
+			return a.letters[r-'A'] - 'a' + 'A'
+		case r >= '0' && r <= '9':
+			return a.digits[r-'0']
+		}
+		return r
+	}, s)
+}
+
+// decimal adds the offset to q, keeping the differences between amounts,
+// which -amount-tolerance compares
+func (a *anonymizer) decimal(q *big.Rat) *big.Rat {
+	return new(big.Rat).Add(q, new(big.Rat).SetInt64(a.offset))
+}
+
+// quantity is decimal for q, a number like -10.50, keeping its decimals.
+// Other strings are replaced by a hash.
+func (a *anonymizer) quantity(q string) string {
+	trimmed := strings.TrimSpace(q)
+	r, err := parseNumber(trimmed)
+	if err != nil {
+		return a.text(q)
+	}
+	decimals := 0
+	if i := strings.Index(trimmed, "."); i >= 0 {
+		decimals = len(trimmed) - i - 1
+	}
+	return a.decimal(r).FloatString(decimals)
+}
+
+// date shifts dates by the same number of years, preserving the days between
+// them and the months they are in
+func (a *anonymizer) date(t time.Time) time.Time {
+	return t.AddDate(a.years, 0, 0)
+}
+
+// anonymizeXML returns the transactions of b, the output of `ledger xml`,
+// anonymized and each wrapped in its own document
+func anonymizeXML(a *anonymizer, b []byte) (docs [][]byte, err error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	var stack []string
+	var version string
+	var buf bytes.Buffer
+	var enc *xml.Encoder
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if t.Name.Local == "ledger" {
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "version" {
+						version = attr.Value
+					}
+				}
+			}
+			if t.Name.Local == "transaction" {
+				buf.Reset()
+				fmt.Fprintf(&buf, "<ledger version=%q><transactions>", version)
+				enc = xml.NewEncoder(&buf)
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				t = xml.CharData(a.element(stack[len(stack)-1], string(t)))
+			}
+			tok = t
+		}
+
+		if enc != nil {
+			if err := enc.EncodeToken(xml.CopyToken(tok)); err != nil {
+				return nil, err
+			}
+		}
+
+		if end, ok := tok.(xml.EndElement); ok {
+			stack = stack[:len(stack)-1]
+			if end.Name.Local == "transaction" && enc != nil {
+				if err := enc.Flush(); err != nil {
+					return nil, err
+				}
+				buf.WriteString("</transactions></ledger>\n")
+				docs = append(docs, append([]byte(nil), buf.Bytes()...))
+				enc = nil
+			}
+		}
+	}
+}
+
+// element anonymizes the text s of an element called name
+func (a *anonymizer) element(name string, s string) string {
+	switch name {
+	case "payee":
+		return a.payee(s)
+	case "note", "string", "tag", "code":
+		return a.text(s)
+	case "name", "fullname":
+		return a.account(s)
+	case "quantity":
+		return a.quantity(s)
+	case "date", "aux-date":
+		t, err := time.Parse("2006/01/02", strings.TrimSpace(s))
+		if err != nil {
+			return a.text(s)
+		}
+		return a.date(t).Format("2006/01/02")
+	}
+	return s
+}
+
+// fuzzCorpus implements `fuzz-corpus export`, writing anonymized seed inputs
+// for parser fuzzing, one transaction per file
+func fuzzCorpus(args []string, ledgerArgs string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return fmt.Errorf("usage: fuzz-corpus export [-o dir] file...")
+	}
+	fs := flag.NewFlagSet("fuzz-corpus export", flag.ExitOnError)
+	dir := fs.String("o", "corpus", "`directory` to write seed inputs to")
+	fs.Parse(args[1:])
+
+	a, err := newAnonymizer()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	for _, fileName := range fs.Args() {
+		b, err := readInput(fileName)
+		if err == nil && !strings.HasPrefix(strings.TrimSpace(string(b)), "<") {
+			b, err = exportXML(fileName, ledgerArgs)
+		}
+		if err != nil {
+			return err
+		}
+		docs, err := anonymizeXML(a, b)
+		if err != nil {
+			return fmt.Errorf("%v: %w", fileName, err)
+		}
+		for _, doc := range docs {
+			sum := sha256.Sum256(doc)
+			name := filepath.Join(*dir, hex.EncodeToString(sum[:8])+".xml")
+			if err := ioutil.WriteFile(name, doc, 0o644); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%v: %v seed inputs written to %v\n", fileName, len(docs), *dir)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// git runs git in dir, returning its output
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("running git %v: %w: %s", strings.Join(args, " "), err, out)
+	}
+	return string(out), nil
+}
+
+// commitSteps creates branch in the git repository of the journals of j and
+// commits the edits of each step on it, in a temporary worktree for the
+// checkout to be left as is. The journals must all be in the same repository
+// and have no uncommitted changes.
+func commitSteps(j journals, steps [][]merge, branch string) (err error) {
+	if len(steps) == 0 {
+		return nil
+	}
+	// Paths of the journals relative to the toplevel of their repository
+	rel := make(map[string]string)
+	var top string
+	var files []string
+	for file := range j {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if abs, err = filepath.EvalSymlinks(abs); err != nil {
+			return err
+		}
+		out, err := git(filepath.Dir(abs), "rev-parse", "--show-toplevel")
+		if err != nil {
+			return err
+		}
+		fileTop := strings.TrimSpace(out)
+		if top == "" {
+			top = fileTop
+		} else if fileTop != top {
+			return fmt.Errorf("journals are in several git repositories, %v and %v", top, fileTop)
+		}
+		if rel[file], err = filepath.Rel(top, abs); err != nil {
+			return err
+		}
+		files = append(files, abs)
+	}
+
+	status, err := git(top, append([]string{"status", "--porcelain", "--"}, files...)...)
+	if err != nil {
+		return err
+	}
+	if status != "" {
+		return fmt.Errorf("journals have uncommitted changes:\n%v", status)
+	}
+	tmp, err := os.MkdirTemp("", "ledger-lint-duplicate-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	worktree := filepath.Join(tmp, "worktree")
+	if _, err := git(top, "worktree", "add", "-q", "-b", branch, worktree); err != nil {
+		return err
+	}
+	defer func() {
+		if _, removeErr := git(top, "worktree", "remove", "--force", worktree); removeErr != nil && err == nil {
+			err = removeErr
+		}
+		// Rather no branch than a half-built one
+		if err != nil {
+			if _, deleteErr := git(top, "branch", "-D", branch); deleteErr != nil {
+				slog.Error("could not delete the branch", "branch", branch, "err", deleteErr)
+			}
+		}
+	}()
+
+	// Each commit has the edits of the steps so far, starting from the
+	// original journals, for line numbers to stay valid
+	var edits []merge
+	for _, step := range steps {
+		edits = append(edits, step...)
+		edited, err := editJournals(j, edits, false)
+		if err != nil {
+			return err
+		}
+		var changed []string
+		for file, lines := range edited {
+			if err := writeFile(filepath.Join(worktree, rel[file]), []byte(strings.Join(lines, "\n"))); err != nil {
+				return err
+			}
+			changed = append(changed, rel[file])
+		}
+		if _, err := git(worktree, append([]string{"add", "--"}, changed...)...); err != nil {
+			return err
+		}
+		if _, err := git(worktree, "commit", "-q", "-m", stepMessage(j, step)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stepMessage describes the edits of step, for its commit
+func stepMessage(j journals, step []merge) string {
+	m := step[0]
+	header := func(l location) string {
+		return strings.TrimSpace(j[l.file][l.line-1])
+	}
+	var b strings.Builder
+	if len(m.remove) > 0 {
+		fmt.Fprintf(&b, "Merge duplicates %v\n\n", m.fingerprint)
+		fmt.Fprintf(&b, "Kept:    %v %v\n", m.keep, header(m.keep))
+		for _, l := range m.remove {
+			fmt.Fprintf(&b, "Removed: %v %v\n", l, header(l))
+		}
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Mark %v as reviewed\n\n", m.fingerprint)
+	for _, r := range step {
+		fmt.Fprintf(&b, "Not a duplicate: %v %v\n", r.keep, header(r.keep))
+	}
+	return b.String()
+}
+
+// blame returns the commit that last changed line of file, as its short hash
+// and summary
+func blame(file string, line int) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	out, err := git(filepath.Dir(abs), "blame", "--porcelain", "-L", fmt.Sprintf("%v,%v", line, line), "--", abs)
+	if err != nil {
+		return "", err
+	}
+	var hash, summary string
+	for i, l := range strings.Split(out, "\n") {
+		if i == 0 {
+			hash, _, _ = strings.Cut(l, " ")
+		} else if s, ok := strings.CutPrefix(l, "summary "); ok {
+			summary = s
+		}
+	}
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	return strings.TrimSpace(hash + " " + summary), nil
+}
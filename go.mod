@@ -1,5 +1,13 @@
 module joly.pw/ledger-lint-duplicate
 
-go 1.16
+go 1.21
 
-require zgo.at/zli v0.0.0-20210330134141-b5f2a73532d6 // indirect
+require (
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	zgo.at/zli v0.0.0-20210330134141-b5f2a73532d6
+)
+
+require (
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	golang.org/x/term v0.0.0-20220526004731-065cf7ba2467 // indirect
+)
@@ -0,0 +1,101 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"math/big"
+	"slices"
+	"sort"
+)
+
+// A Posting of a transaction, with -granularity transaction
+type Posting struct {
+	Account   string  `json:"account"`
+	Amount    float64 `json:"-"`
+	Commodity string  `json:"commodity,omitempty"`
+	// Quantity is the exact decimal of Amount, see Tx, and what it is
+	// written as in JSON
+	Quantity string `json:"-"`
+}
+
+var granularity = flag.String("granularity", "posting", "what duplicates are made of: posting, or transaction for transactions with the same postings")
+
+// byTransaction returns a posting for each transaction of txs, its largest
+// one, usually the charge, with the Postings of the transaction, to search
+// duplicate transactions rather than duplicate postings
+func byTransaction(txs map[amountKey][]Tx) map[amountKey][]Tx {
+	type transaction struct {
+		input    string
+		position int
+	}
+	chosen := make(map[transaction]Tx)
+	postings := make(map[transaction][]Posting)
+	for _, bucket := range txs {
+		for _, tx := range bucket {
+			t := transaction{tx.Input, tx.Position}
+			postings[t] = append(postings[t], Posting{tx.Account, tx.Amount, tx.Commodity, tx.quantity()})
+			if c, exists := chosen[t]; !exists || chosenOver(&tx, &c) {
+				chosen[t] = tx
+			}
+		}
+	}
+	transactions := make(map[amountKey][]Tx)
+	for t, tx := range chosen {
+		tx.Postings = postings[t]
+		sort.Slice(tx.Postings, func(i, j int) bool {
+			a, b := tx.Postings[i], tx.Postings[j]
+			if a.Account != b.Account {
+				return a.Account < b.Account
+			}
+			if a.Commodity != b.Commodity {
+				return a.Commodity < b.Commodity
+			}
+			if c := a.exact().Cmp(b.exact()); c != 0 {
+				return c < 0
+			}
+			return a.Quantity < b.Quantity
+		})
+		transactions[tx.key()] = append(transactions[tx.key()], tx)
+	}
+	return transactions
+}
+
+// chosenOver tells whether posting a rather than b stands for their
+// transaction: the largest one, usually the charge, then the first account
+func chosenOver(a, b *Tx) bool {
+	if c := compareAmounts(a, b); c != 0 {
+		return c > 0
+	}
+	return a.Account < b.Account
+}
+
+// exact returns the amount of p as an exact decimal
+func (p *Posting) exact() *big.Rat {
+	if q, ok := new(big.Rat).SetString(p.Quantity); ok {
+		return q
+	}
+	return decimal(p.Amount)
+}
+
+// samePostings matches transactions with the same postings, from
+// byTransaction
+func samePostings(a, b *Tx) bool {
+	return slices.Equal(a.Postings, b.Postings)
+}
@@ -0,0 +1,195 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// An hledgerTransaction is a transaction of `hledger print -O json`
+type hledgerTransaction struct {
+	Date        string           `json:"tdate"`
+	Description string           `json:"tdescription"`
+	Status      string           `json:"tstatus"`
+	Comment     string           `json:"tcomment"`
+	Tags        [][2]string      `json:"ttags"`
+	Postings    []hledgerPosting `json:"tpostings"`
+	// SourcePos is the start and end of the transaction in its journal, or
+	// with hledger before 1.26, {"contents": [file, [start, end]]}
+	SourcePos json.RawMessage `json:"tsourcepos"`
+}
+
+type hledgerPosting struct {
+	Date      *string         `json:"pdate"`
+	Account   string          `json:"paccount"`
+	Amounts   []hledgerAmount `json:"pamount"`
+	Status    string          `json:"pstatus"`
+	Comment   string          `json:"pcomment"`
+	Tags      [][2]string     `json:"ptags"`
+	Assertion *struct {
+		Amount hledgerAmount `json:"baamount"`
+	} `json:"pbalanceassertion"`
+}
+
+type hledgerAmount struct {
+	Commodity string `json:"acommodity"`
+	Quantity  struct {
+		Mantissa json.Number `json:"decimalMantissa"`
+		Places   int         `json:"decimalPlaces"`
+	} `json:"aquantity"`
+}
+
+// quantity returns the exact quantity of a, a decimal mantissa and places
+func (a hledgerAmount) quantity() (*big.Rat, error) {
+	q, ok := new(big.Rat).SetString(a.Quantity.Mantissa.String())
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %v", a.Quantity.Mantissa)
+	}
+	return q.Quo(q, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(a.Quantity.Places)), nil))), nil
+}
+
+// hledgerStates are the states of transactions and postings by their status
+var hledgerStates = map[string]string{"Cleared": "cleared", "Pending": "pending"}
+
+// source returns the file and line of the start of t, if known
+func (t *hledgerTransaction) source() (string, int) {
+	var positions []struct {
+		Name string `json:"sourceName"`
+		Line int    `json:"sourceLine"`
+	}
+	if json.Unmarshal(t.SourcePos, &positions) == nil && len(positions) > 0 {
+		return positions[0].Name, positions[0].Line
+	}
+	var old struct {
+		Contents []json.RawMessage `json:"contents"`
+	}
+	if json.Unmarshal(t.SourcePos, &old) == nil && len(old.Contents) == 2 {
+		var name string
+		var lines [2]int
+		if json.Unmarshal(old.Contents[0], &name) == nil && json.Unmarshal(old.Contents[1], &lines) == nil {
+			return name, lines[0]
+		}
+	}
+	return "", 0
+}
+
+// hledgerTags returns the tags of tags, those without value, and the
+// metadata, those with one
+func hledgerTags(tags [][2]string) (names []string, metadata map[string]string) {
+	for _, tag := range tags {
+		if tag[1] == "" {
+			names = append(names, tag[0])
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[tag[0]] = tag[1]
+	}
+	return names, metadata
+}
+
+// parseHledger reads the postings of b, the output of `hledger print -O
+// json`. Postings have the line of their transaction.
+func parseHledger(fileName string, b []byte) (map[amountKey][]Tx, error) {
+	var transactions []hledgerTransaction
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.UseNumber()
+	if err := d.Decode(&transactions); err != nil {
+		return nil, fmt.Errorf("%v: %w", fileName, err)
+	}
+	txs := make(map[amountKey][]Tx)
+	strs := make(interner)
+	for position, t := range transactions {
+		date, err := time.Parse("2006-01-02", t.Date)
+		if err != nil {
+			return nil, fmt.Errorf("%v: transaction %v: %w", fileName, position, err)
+		}
+		file, line := t.source()
+		tags, metadata := hledgerTags(t.Tags)
+		payee := strs.intern(t.Description)
+		for _, p := range t.Postings {
+			postingDate := date
+			if p.Date != nil {
+				if postingDate, err = time.Parse("2006-01-02", *p.Date); err != nil {
+					return nil, fmt.Errorf("%v: transaction %v: %w", fileName, position, err)
+				}
+			}
+			postingTags, postingMetadata := hledgerTags(p.Tags)
+			if len(postingMetadata) > 0 {
+				// Posting metadata takes precedence
+				for k, v := range metadata {
+					if _, exists := postingMetadata[k]; !exists {
+						postingMetadata[k] = v
+					}
+				}
+			} else {
+				postingMetadata = metadata
+			}
+			for _, a := range p.Amounts {
+				amount, err := a.quantity()
+				if err != nil {
+					return nil, fmt.Errorf("%v: transaction %v: %w", fileName, position, err)
+				}
+				tx := Tx{
+					Tx: dedupe.Tx{
+						Date:      postingDate,
+						File:      strs.intern(file),
+						Line:      line,
+						Payee:     payee,
+						Account:   strs.intern(p.Account),
+						Commodity: strs.intern(a.Commodity),
+						Tags:      tags,
+						Metadata:  postingMetadata,
+					},
+					Position:    position,
+					HeaderLine:  line,
+					PostingTags: postingTags,
+					State:       hledgerStates[t.Status],
+					Note:        strings.TrimSpace(t.Comment),
+				}
+				tx.setQuantity(amount)
+				if s := hledgerStates[p.Status]; s != "" {
+					tx.State = s
+				}
+				if c := strings.TrimSpace(p.Comment); c != "" {
+					tx.Note = c
+				}
+				if p.Assertion != nil {
+					if q, err := p.Assertion.Amount.quantity(); err == nil {
+						assertion := toFloat(q)
+						tx.Assertion = &assertion
+					}
+				}
+				if reason := skipped(&tx); reason != "" {
+					audit(reason, &tx)
+					continue
+				}
+				txs[tx.key()] = append(txs[tx.key()], tx)
+			}
+		}
+	}
+	return txs, nil
+}
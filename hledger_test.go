@@ -0,0 +1,78 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHledger(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		json string
+		want []string
+		err  string
+	}{
+		{"postings", `[{"tdate": "2024-03-01", "tdescription": "Shop", "tstatus": "Cleared",
+"tsourcepos": [{"sourceName": "bank.journal", "sourceLine": 3, "sourceColumn": 1}],
+"ttags": [["trip", ""]],
+"tpostings": [
+	{"paccount": "Expenses:Food", "pstatus": "Unmarked", "ptags": [["notDup", ""]],
+	 "pamount": [{"acommodity": "EUR", "aquantity": {"decimalMantissa": 1050, "decimalPlaces": 2}}]},
+	{"paccount": "Assets:Bank", "pstatus": "Pending", "pdate": "2024-03-02",
+	 "pamount": [{"acommodity": "EUR", "aquantity": {"decimalMantissa": -1050, "decimalPlaces": 2}}]}
+]}]`, []string{
+			"bank.journal:3 2024-03-01 cleared Shop Expenses:Food 10.5 EUR [trip notDup]",
+			"bank.journal:3 2024-03-02 pending Shop Assets:Bank -10.5 EUR [trip]",
+		}, ""},
+		{"before hledger 1.26", `[{"tdate": "2024-03-01", "tdescription": "Shop",
+"tsourcepos": {"tag": "JournalSourcePos", "contents": ["bank.journal", [7, 9]]},
+"tpostings": [{"paccount": "Assets:Bank",
+	"pamount": [{"acommodity": "$", "aquantity": {"decimalMantissa": 3, "decimalPlaces": 0}}]}]}]`, []string{
+			"bank.journal:7 2024-03-01  Shop Assets:Bank 3 $ []",
+		}, ""},
+		{"several commodities", `[{"tdate": "2024-03-01", "tdescription": "Exchange", "tpostings": [{"paccount": "Assets:Bank", "pamount": [
+	{"acommodity": "EUR", "aquantity": {"decimalMantissa": 1, "decimalPlaces": 0}},
+	{"acommodity": "USD", "aquantity": {"decimalMantissa": 2, "decimalPlaces": 0}}
+]}]}]`, []string{
+			"0 2024-03-01  Exchange Assets:Bank 1 EUR []",
+			"0 2024-03-01  Exchange Assets:Bank 2 USD []",
+		}, ""},
+		{"invalid date", `[{"tdate": "01/03/2024", "tpostings": []}]`, nil, "transaction 0"},
+		{"not json", `2024-03-01 Shop`, nil, "bank.json"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			txs, err := parseHledger("bank.json", []byte(c.json))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describePostings(txs); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got postings\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(c.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRequestBytes is the largest request body read, for a /check-batch of
+// tens of thousands of candidates
+const maxRequestBytes = 16 << 20
+
+// httpServer serves the workspaces over HTTP, with POST /check taking a
+// Candidate and answering a Verdict, and POST /check-batch taking many, as a
+// JSON array or as CSV like queued files, and answering an array of Verdicts
+// in the same order
+type httpServer struct {
+	ws Workspaces
+	// tokens accepted in "Authorization: Bearer" headers, none meaning no
+	// authentication
+	tokens  []string
+	limiter *rateLimiter
+}
+
+func (s *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client, ok := s.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.limiter != nil && !s.limiter.allow(client) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	if r.URL.Path != "/check" && r.URL.Path != "/check-batch" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	if r.URL.Path == "/check-batch" {
+		s.checkBatch(w, r)
+		return
+	}
+	var c Candidate
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		badRequest(w, err)
+		return
+	}
+	v := s.ws.check(c)
+	v.Version = schemaVersion
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// checkBatch answers the verdicts of the candidates of a /check-batch request
+func (s *httpServer) checkBatch(w http.ResponseWriter, r *http.Request) {
+	var candidates []Candidate
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+		candidates, err = csvCandidates(r.Body)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&candidates)
+	}
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	verdicts := make([]Verdict, 0, len(candidates))
+	for _, c := range candidates {
+		v := s.ws.check(c)
+		v.Version = schemaVersion
+		verdicts = append(verdicts, v)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verdicts)
+}
+
+// badRequest answers err, met reading the request body
+func badRequest(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// splitTokens returns the comma separated tokens of s, without blanks
+func splitTokens(s string) []string {
+	var tokens []string
+	for _, token := range strings.Split(s, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// authenticate returns the client to rate limit: its token, or its address
+// when no token is required
+func (s *httpServer) authenticate(r *http.Request) (client string, ok bool) {
+	if len(s.tokens) == 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return host, true
+	}
+	given, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return "", false
+	}
+	for _, token := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// rateLimiter is a token bucket per client, allowing bursts of up to
+// perMinute requests
+type rateLimiter struct {
+	perMinute float64
+	mu        sync.Mutex
+	buckets   map[string]*rateBucket
+	// lastSweep is when idle buckets were last evicted
+	lastSweep time.Time
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{perMinute: float64(perMinute), buckets: make(map[string]*rateBucket), lastSweep: time.Now()}
+}
+
+func (l *rateLimiter) allow(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	// A bucket idle for a minute is full again, like a new one, so it
+	// can go
+	if now.Sub(l.lastSweep) >= time.Minute {
+		for c, b := range l.buckets {
+			if now.Sub(b.last) >= time.Minute {
+				delete(l.buckets, c)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, exists := l.buckets[client]
+	if !exists {
+		b = &rateBucket{tokens: l.perMinute, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens += now.Sub(b.last).Minutes() * l.perMinute
+	if b.tokens > l.perMinute {
+		b.tokens = l.perMinute
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,218 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultIgnoreFile is read, if it exists, when -ignore-file is not given
+const defaultIgnoreFile = ".ledger-lint-ignore"
+
+var ignoreFile = flag.String("ignore-file", defaultIgnoreFile, "`file` listing the fingerprints of findings never to report, and rules of postings never to read, one per line")
+
+// An ignoreRule leaves out the postings matching all its conditions, or
+// reads them again when negated, the last rule matching a posting deciding,
+// like in .gitignore files
+type ignoreRule struct {
+	line    int
+	negated bool
+	// payee, account and commodity are globs, and nil when any matches
+	payee, account, commodity *regexp.Regexp
+	// from and to are the first and last days, zero when unbounded
+	from, to time.Time
+	// minAmount and maxAmount bound the amount, whatever its sign
+	minAmount, maxAmount float64
+}
+
+// ignoreRules are the rules of the ignore file, checked by skipped
+var ignoreRules []ignoreRule
+
+// loadIgnored returns the fingerprints and the rules listed in the ignore
+// file at path, one per line. Lines starting with # are comments, as is what
+// follows a fingerprint, and rules are conditions on payee, account,
+// commodity, date and amount, quoted like in a shell, a rule starting with !
+// reading again the postings of previous ones, like
+//
+//	# Two coffees at the same shop
+//	c7237cb1e89e 2021-05-01 Coffee
+//	# Trades, but the big ones
+//	account:Assets:Brokerage:*
+//	!account:Assets:Brokerage:* amount:10000..
+//	payee:"Amazon *" date:2020-01-01..2020-12-31 amount:9.99
+func loadIgnored(path string) (map[string]bool, []ignoreRule, error) {
+	b, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && path == defaultIgnoreFile {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	ignored := make(map[string]bool)
+	var rules []ignoreRule
+	for i, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if !strings.HasPrefix(fields[0], "!") && !strings.Contains(fields[0], ":") {
+			ignored[strings.ToLower(fields[0])] = true
+			continue
+		}
+		rule, err := parseIgnoreRule(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%v:%v: %w", path, i+1, err)
+		}
+		rule.line = i + 1
+		rules = append(rules, rule)
+	}
+	return ignored, rules, nil
+}
+
+// parseIgnoreRule parses the conditions of a rule of the ignore file
+func parseIgnoreRule(line string) (ignoreRule, error) {
+	rule := ignoreRule{maxAmount: math.Inf(1)}
+	line = strings.TrimSpace(line)
+	if rest, ok := strings.CutPrefix(line, "!"); ok {
+		rule.negated, line = true, rest
+	}
+	conditions, err := splitArgs(line)
+	if err != nil {
+		return rule, err
+	}
+	for _, c := range conditions {
+		key, value, _ := strings.Cut(c, ":")
+		switch key {
+		case "payee":
+			rule.payee = globRegexp(value)
+		case "account":
+			rule.account = globRegexp(value)
+		case "commodity":
+			rule.commodity = globRegexp(value)
+		case "date":
+			from, to, isRange := strings.Cut(value, "..")
+			if !isRange {
+				to = from
+			}
+			if from != "" {
+				if rule.from, err = time.Parse("2006-01-02", from); err != nil {
+					return rule, err
+				}
+			}
+			if to != "" {
+				if rule.to, err = time.Parse("2006-01-02", to); err != nil {
+					return rule, err
+				}
+			}
+		case "amount":
+			from, to, isRange := strings.Cut(value, "..")
+			if !isRange {
+				to = from
+			}
+			if from != "" {
+				if rule.minAmount, err = strconv.ParseFloat(from, 64); err != nil {
+					return rule, err
+				}
+			}
+			if to != "" {
+				if rule.maxAmount, err = strconv.ParseFloat(to, 64); err != nil {
+					return rule, err
+				}
+			}
+		default:
+			return rule, fmt.Errorf("unknown condition %q, expected payee, account, commodity, date or amount", c)
+		}
+	}
+	return rule, nil
+}
+
+// globRegexp returns a regexp matching the whole strings matched by glob, *
+// standing for any characters and ? for one, case-insensitively
+func globRegexp(glob string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(glob)
+	quoted = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(quoted)
+	return regexp.MustCompile("(?i)^" + quoted + "$")
+}
+
+// matches tells whether tx meets all the conditions of r
+func (r *ignoreRule) matches(tx *Tx) bool {
+	amount := math.Abs(tx.Amount)
+	return (r.payee == nil || r.payee.MatchString(tx.Payee)) &&
+		(r.account == nil || r.account.MatchString(tx.Account)) &&
+		(r.commodity == nil || r.commodity.MatchString(tx.Commodity)) &&
+		(r.from.IsZero() || !tx.Date.Before(r.from)) &&
+		(r.to.IsZero() || !tx.Date.After(r.to)) &&
+		amount >= r.minAmount && amount <= r.maxAmount
+}
+
+// ruleIgnored returns the line of the rule of ignoreRules leaving out tx, if
+// any
+func ruleIgnored(tx *Tx) (line int, ignored bool) {
+	return ignoredBy(ignoreRules, tx)
+}
+
+// ignoredBy returns the line of the rule of rules leaving out tx, if any, the
+// last matching rule deciding
+func ignoredBy(rules []ignoreRule, tx *Tx) (line int, ignored bool) {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if r := &rules[i]; r.matches(tx) {
+			return r.line, !r.negated
+		}
+	}
+	return 0, false
+}
+
+// dropIgnored returns groups without those whose fingerprint is ignored
+func dropIgnored(ignored map[string]bool, groups [][]*Tx) (kept [][]*Tx) {
+	if len(ignored) == 0 {
+		return groups
+	}
+	for _, g := range groups {
+		if ignored[fingerprint(g...)] {
+			auditGroup("fingerprint in the ignore file", "duplicate", g)
+		} else {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// withoutIgnored returns findings without those whose fingerprint is ignored
+func withoutIgnored(findings []finding, ignored map[string]bool) (kept []finding) {
+	if len(ignored) == 0 {
+		return findings
+	}
+	for _, f := range findings {
+		if ignored[f.id()] {
+			auditGroup("fingerprint in the ignore file", f.rule, f.txs)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,103 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+func TestLoadIgnored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ignore")
+	err := os.WriteFile(path, []byte(`# Two coffees at the same shop
+C7237CB1E89E 2021-05-01 Coffee
+# Trades, but the big ones
+account:Assets:Brokerage:*
+!account:Assets:Brokerage:* amount:10000..
+payee:"Amazon *" date:2020-01-01..2020-12-31 amount:9.99
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignored, rules, err := loadIgnored(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ignored) != 1 || !ignored["c7237cb1e89e"] {
+		t.Errorf("got ignored fingerprints %v", ignored)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("got %v rules, want 3", len(rules))
+	}
+
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	for _, c := range []struct {
+		name    string
+		tx      dedupe.Tx
+		line    int
+		ignored bool
+	}{
+		{"trade", dedupe.Tx{Account: "Assets:Brokerage:ACME", Amount: -500}, 4, true},
+		{"big trade", dedupe.Tx{Account: "Assets:Brokerage:ACME", Amount: -20000}, 5, false},
+		{"other account", dedupe.Tx{Account: "Assets:Bank", Amount: -500}, 0, false},
+		{"subscription", dedupe.Tx{Payee: "AMAZON Prime", Date: date("2020-06-01"), Amount: -9.99}, 6, true},
+		{"subscription out of dates", dedupe.Tx{Payee: "Amazon Prime", Date: date("2021-06-01"), Amount: -9.99}, 0, false},
+		{"other amount", dedupe.Tx{Payee: "Amazon Prime", Date: date("2020-06-01"), Amount: -10}, 0, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			line, ignored := ignoredBy(rules, &Tx{Tx: c.tx})
+			if line != c.line || ignored != c.ignored {
+				t.Errorf("got rule at line %v, ignored %v, want line %v, ignored %v", line, ignored, c.line, c.ignored)
+			}
+		})
+	}
+}
+
+func TestParseIgnoreRule(t *testing.T) {
+	for _, c := range []struct {
+		rule, err string
+	}{
+		{"payee:Shop*", ""},
+		{`payee:"Coffee shop" commodity:EUR`, ""},
+		{"date:2020-01-01..", ""},
+		{"date:2020-13-01", "month out of range"},
+		{"amount:ten", "invalid syntax"},
+		{"size:10", `unknown condition "size:10"`},
+		{`payee:"Coffee`, "unterminated quote"},
+	} {
+		_, err := parseIgnoreRule(c.rule)
+		if c.err == "" && err != nil {
+			t.Errorf("%v: got error %v", c.rule, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%v: got error %v, want %q", c.rule, err, c.err)
+		}
+	}
+}
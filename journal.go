@@ -0,0 +1,538 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+var parser = flag.String("parser", "auto", "how journals are read: ledger, exporting them with `ledger xml`, register, exporting them with ledger register for builds without xml, hledger, exporting them with hledger print -O json, beancount, reading Beancount files, as for files named *.beancount or *.bean, csv, reading CSV like bank exports, as for files named *.csv, native, parsing them directly, or auto, natively only when ledger is not installed")
+
+// nativeParser returns true if journals are to be parsed directly, rather
+// than exported by ledger
+func nativeParser() bool {
+	switch *parser {
+	case "native":
+		return true
+	case "ledger", "register", "hledger", "beancount", "csv":
+		return false
+	}
+	_, err := exec.LookPath("ledger")
+	return err != nil
+}
+
+// accountDirectives tracks the "apply account" and "alias" directives of a
+// journal or time file, that rewrite the account names following them
+type accountDirectives struct {
+	parents []string
+	aliases []alias
+}
+
+// read applies the directive on line, returning false if it is not one
+func (d *accountDirectives) read(fileName string, line int, text string) bool {
+	keyword, rest, _ := strings.Cut(strings.TrimSpace(text), " ")
+	rest = strings.TrimSpace(rest)
+	switch {
+	case keyword == "apply" && strings.HasPrefix(rest, "account "):
+		d.parents = append(d.parents, d.prefix(strings.TrimSpace(strings.TrimPrefix(rest, "account "))))
+	case keyword == "end" && (rest == "" || strings.HasPrefix(rest, "apply account")):
+		if len(d.parents) > 0 {
+			d.parents = d.parents[:len(d.parents)-1]
+		}
+	case keyword == "end" && rest == "aliases":
+		d.aliases = nil
+	case keyword == "alias":
+		from, to, ok := strings.Cut(rest, "=")
+		if !ok {
+			return false
+		}
+		d.aliases = append(d.aliases, alias{fileName, line, strings.TrimSpace(from), d.prefix(strings.TrimSpace(to))})
+	default:
+		return false
+	}
+	return true
+}
+
+// prefix returns account under the applied parent account, if any
+func (d *accountDirectives) prefix(account string) string {
+	if len(d.parents) == 0 {
+		return account
+	}
+	return d.parents[len(d.parents)-1] + ":" + account
+}
+
+// expand returns account, as written, with the last matching alias applied
+// or else under the applied parent account, as ledger does: targets of
+// aliases are under the parent account applied where they are defined.
+func (d *accountDirectives) expand(account string) string {
+	for i := len(d.aliases) - 1; i >= 0; i-- {
+		a := d.aliases[i]
+		if account == a.from || strings.HasPrefix(account, a.from+":") {
+			return a.to + strings.TrimPrefix(account, a.from)
+		}
+	}
+	return d.prefix(account)
+}
+
+// journalPosting is a posting being read, its amount possibly elided or
+// given by a balance assignment
+type journalPosting struct {
+	Tx
+	hasAmount bool
+	// virtual is '(' for virtual postings, '[' for balanced virtual ones
+	virtual byte
+	// quantity is the exact Amount, and weight what the posting contributes
+	// to the balance of the transaction, in costCommodity with a cost
+	quantity, weight *big.Rat
+	costCommodity    string
+}
+
+// journalParser reads ledger journals, following their includes. Automated
+// and periodic transactions are skipped, their postings repeating by design.
+type journalParser struct {
+	txs        map[amountKey][]Tx
+	position   int
+	directives accountDirectives
+	bucket     string
+	year       int
+	// balances are by account and commodity, for balance assignments
+	balances map[[2]string]*big.Rat
+	reading  map[string]bool
+
+	// The transaction being read, if header is set
+	header   *Tx
+	postings []journalPosting
+}
+
+// parseJournal returns the postings of the journal fileName, with b its
+// content, by amount
+func parseJournal(fileName string, b []byte) (map[amountKey][]Tx, error) {
+	p := journalParser{
+		txs:      make(map[amountKey][]Tx),
+		year:     time.Now().Year(),
+		balances: make(map[[2]string]*big.Rat),
+		reading:  make(map[string]bool),
+	}
+	if err := p.parse(fileName, b); err != nil {
+		return nil, err
+	}
+	return p.txs, nil
+}
+
+var journalDate = regexp.MustCompile(`^(\d{4}[/.-])?\d{1,2}[/.-]\d{1,2}$`)
+
+func (p *journalParser) date(s string) (time.Time, error) {
+	s, _, _ = strings.Cut(s, "=")
+	if !journalDate.MatchString(s) {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	s = strings.NewReplacer(".", "/", "-", "/").Replace(s)
+	if strings.Count(s, "/") == 1 {
+		s = fmt.Sprintf("%v/%v", p.year, s)
+	}
+	return time.Parse("2006/1/2", s)
+}
+
+func (p *journalParser) parse(fileName string, b []byte) error {
+	if abs, err := filepath.Abs(fileName); err == nil {
+		if p.reading[abs] {
+			return fmt.Errorf("%v: included recursively", fileName)
+		}
+		p.reading[abs] = true
+		defer delete(p.reading, abs)
+	}
+
+	// skipping is the keyword of the block being skipped: = and ~ for
+	// automated and periodic transactions, other directives with
+	// indented sub-directives, "comment" and "test" for blocks up to
+	// their end
+	var skipping, account string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(text)
+		indented := text != "" && (text[0] == ' ' || text[0] == '\t')
+
+		if skipping == "comment" || skipping == "test" {
+			if trimmed == "end "+skipping {
+				skipping = ""
+			}
+			continue
+		}
+		if indented && trimmed != "" {
+			switch {
+			case p.header != nil:
+				if err := p.indented(fileName, line, trimmed); err != nil {
+					return err
+				}
+			case skipping == "account":
+				// An alias of the account declared above
+				if from, ok := strings.CutPrefix(trimmed, "alias "); ok {
+					p.directives.aliases = append(p.directives.aliases, alias{fileName, line, strings.TrimSpace(from), account})
+				}
+			}
+			continue
+		}
+
+		if err := p.flush(); err != nil {
+			return fmt.Errorf("%v:%v: %w", fileName, line-1, err)
+		}
+		skipping = ""
+		if trimmed == "" || strings.ContainsAny(text[:1], ";#%|*") {
+			continue
+		}
+		keyword, rest, _ := strings.Cut(trimmed, " ")
+		rest = strings.TrimSpace(rest)
+		switch {
+		case text[0] >= '0' && text[0] <= '9':
+			if err := p.start(fileName, line, text); err != nil {
+				return fmt.Errorf("%v:%v: %w", fileName, line, err)
+			}
+		case text[0] == '=' || text[0] == '~':
+			skipping = text[:1]
+		case keyword == "include" || keyword == "!include":
+			if err := p.include(fileName, rest); err != nil {
+				return fmt.Errorf("%v:%v: %w", fileName, line, err)
+			}
+		case keyword == "comment" || keyword == "test":
+			skipping = keyword
+		case keyword == "bucket" || keyword == "A":
+			p.bucket = p.directives.expand(rest)
+		case keyword == "year" || keyword == "Y" || keyword == "apply" && strings.HasPrefix(rest, "year "):
+			year, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(rest, "year ")))
+			if err != nil {
+				return fmt.Errorf("%v:%v: invalid year: %w", fileName, line, err)
+			}
+			p.year = year
+		case p.directives.read(fileName, line, text):
+		case keyword == "account":
+			skipping, account = keyword, p.directives.prefix(stripComment(rest))
+		default:
+			// Other directives, like commodity or P, and their
+			// sub-directives
+			skipping = keyword
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%v: %w", fileName, err)
+	}
+	if err := p.flush(); err != nil {
+		return fmt.Errorf("%v: %w", fileName, err)
+	}
+	return nil
+}
+
+// include parses the journals matching pattern, relative to the directory
+// of fileName
+func (p *journalParser) include(fileName, pattern string) error {
+	if strings.HasPrefix(pattern, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		pattern = filepath.Join(home, pattern[2:])
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(fileName), pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no file to include matches %v", pattern)
+	}
+	for _, m := range matches {
+		b, err := ioutil.ReadFile(m)
+		if err != nil {
+			return err
+		}
+		if err := p.parse(m, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripComment returns s without its trailing comment
+func stripComment(s string) string {
+	if i := strings.Index(s, ";"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// comment adds the tags and metadata of the comment c to tx
+func comment(tx *Tx, c string, posting bool) {
+	if c = strings.TrimSpace(c); c != "" {
+		if tx.Note != "" {
+			tx.Note += "\n"
+		}
+		tx.Note += c
+	}
+	tags := noteTags(c)
+	if posting {
+		tx.PostingTags = append(tx.PostingTags, tags...)
+	} else {
+		tx.Tags = append(tx.Tags, tags...)
+	}
+	if m := commentMetadata.FindStringSubmatch(c); m != nil {
+		if tx.Metadata == nil {
+			tx.Metadata = make(map[string]string)
+		}
+		tx.Metadata[m[1]] = strings.TrimSpace(m[2])
+	}
+}
+
+// journalStates are the states of transactions and postings by their mark
+var journalStates = map[byte]string{'*': "cleared", '!': "pending"}
+
+var commentMetadata = regexp.MustCompile(`^\s*([^\s:]+)::?\s+(.*)$`)
+
+// start reads the header of a transaction, like
+// "2021/05/01=2021/05/03 * (123) Payee  ; :tag:"
+func (p *journalParser) start(fileName string, line int, text string) error {
+	text, note, _ := strings.Cut(text, ";")
+	fields := strings.Fields(text)
+	date, err := p.date(fields[0])
+	if err != nil {
+		return err
+	}
+	payee := strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+	var state string
+	if payee != "" && (payee[0] == '*' || payee[0] == '!') {
+		state = journalStates[payee[0]]
+		payee = strings.TrimSpace(payee[1:])
+	}
+	if strings.HasPrefix(payee, "(") {
+		if i := strings.Index(payee, ")"); i >= 0 {
+			payee = strings.TrimSpace(payee[i+1:])
+		}
+	}
+	p.header = &Tx{Tx: dedupe.Tx{Date: date, File: fileName, Line: line, Payee: payee}, Position: p.position, State: state}
+	p.position++
+	comment(p.header, note, false)
+	return nil
+}
+
+// indented reads a posting or a comment of the current transaction
+func (p *journalParser) indented(fileName string, line int, trimmed string) error {
+	if trimmed[0] == ';' || trimmed[0] == '#' {
+		if len(p.postings) == 0 {
+			comment(p.header, trimmed[1:], false)
+		} else {
+			comment(&p.postings[len(p.postings)-1].Tx, trimmed[1:], true)
+		}
+		return nil
+	}
+
+	text, note, _ := strings.Cut(trimmed, ";")
+	var state string
+	if text[0] == '*' || text[0] == '!' {
+		state = journalStates[text[0]]
+		text = strings.TrimSpace(text[1:])
+	}
+	account, amount := text, ""
+	if i := strings.Index(text, "\t"); i >= 0 {
+		account, amount = text[:i], text[i:]
+	}
+	if i := strings.Index(account, "  "); i >= 0 {
+		account, amount = text[:i], text[i:]
+	}
+	account = strings.TrimSpace(account)
+	posting := journalPosting{Tx: Tx{Tx: dedupe.Tx{Line: line}, State: state}}
+	if n := len(account); n > 2 && (account[0] == '(' && account[n-1] == ')' || account[0] == '[' && account[n-1] == ']') {
+		posting.virtual = account[0]
+		account = account[1 : n-1]
+	}
+	posting.Account = p.directives.expand(account)
+	comment(&posting.Tx, note, true)
+
+	amount, assertion, _ := strings.Cut(amount, "=")
+	if amount = strings.TrimSpace(amount); amount != "" {
+		q, commodity, err := parseDecimal(amount)
+		if err != nil {
+			return fmt.Errorf("%v:%v: %w", fileName, line, err)
+		}
+		posting.setQuantity(q)
+		posting.Commodity, posting.hasAmount = commodity, true
+		posting.quantity, posting.weight, posting.costCommodity = q, q, commodity
+		if err := posting.cost(amount); err != nil {
+			return fmt.Errorf("%v:%v: %w", fileName, line, err)
+		}
+	}
+	if assertion = strings.TrimSpace(assertion); assertion != "" {
+		q, commodity, err := parseDecimal(assertion)
+		if err != nil {
+			return fmt.Errorf("%v:%v: %w", fileName, line, err)
+		}
+		asserted := toFloat(q)
+		posting.Assertion = &asserted
+		if !posting.hasAmount {
+			// A balance assignment
+			posting.quantity = new(big.Rat).Set(q)
+			if balance := p.balances[[2]string{posting.Account, commodity}]; balance != nil {
+				posting.quantity.Sub(q, balance)
+			}
+			posting.setQuantity(posting.quantity)
+			posting.Commodity = commodity
+			posting.weight, posting.costCommodity, posting.hasAmount = posting.quantity, commodity, true
+		}
+	}
+	p.postings = append(p.postings, posting)
+	return nil
+}
+
+// cost sets the weight of the posting from its cost in amount, if any, like
+// "10 AAPL @ $50", "10 AAPL @@ $500" or "10 AAPL {$50}"
+func (post *journalPosting) cost(amount string) error {
+	var perUnit bool
+	var price string
+	switch {
+	case strings.Contains(amount, "@@"):
+		_, price, _ = strings.Cut(amount, "@@")
+	case strings.Contains(amount, "@"):
+		_, price, _ = strings.Cut(amount, "@")
+		perUnit = true
+	case strings.Contains(amount, "{{"):
+		_, price, _ = strings.Cut(amount, "{{")
+		price, _, _ = strings.Cut(price, "}}")
+	case strings.Contains(amount, "{"):
+		_, price, _ = strings.Cut(amount, "{")
+		price, _, _ = strings.Cut(price, "}")
+		perUnit = true
+	default:
+		return nil
+	}
+	q, commodity, err := parseDecimal(strings.TrimPrefix(strings.TrimSpace(price), "="))
+	if err != nil {
+		return err
+	}
+	if perUnit {
+		q.Mul(q, post.quantity)
+	} else if post.quantity.Sign() < 0 {
+		q.Abs(q).Neg(q)
+	}
+	post.weight, post.costCommodity = q, commodity
+	return nil
+}
+
+// flush completes the current transaction, giving elided amounts the
+// balance of the others, and adds its postings to txs
+func (p *journalParser) flush() error {
+	if p.header == nil {
+		return nil
+	}
+	header, postings := p.header, p.postings
+	p.header, p.postings = nil, nil
+
+	var complete []journalPosting
+	for _, virtual := range []byte{0, '[', '('} {
+		sums := make(map[string]*big.Rat)
+		var commodities []string
+		var elided []journalPosting
+		for _, post := range postings {
+			if post.virtual != virtual {
+				continue
+			}
+			if !post.hasAmount {
+				elided = append(elided, post)
+				continue
+			}
+			if _, exists := sums[post.costCommodity]; !exists {
+				commodities = append(commodities, post.costCommodity)
+				sums[post.costCommodity] = new(big.Rat)
+			}
+			sums[post.costCommodity].Add(sums[post.costCommodity], post.weight)
+			complete = append(complete, post)
+		}
+		if virtual == '(' {
+			continue
+		}
+		if len(elided) > 1 {
+			return fmt.Errorf("only one posting with no amount is allowed per transaction")
+		}
+		if len(elided) == 0 && p.bucket != "" && virtual == 0 {
+			elided = append(elided, journalPosting{Tx: Tx{Tx: dedupe.Tx{Account: p.bucket, Line: header.Line}}})
+		}
+		for _, commodity := range commodities {
+			if sums[commodity].Sign() == 0 || len(elided) == 0 {
+				continue
+			}
+			post := elided[0]
+			post.quantity = new(big.Rat).Neg(sums[commodity])
+			post.setQuantity(post.quantity)
+			post.Commodity = commodity
+			complete = append(complete, post)
+		}
+	}
+
+	for _, post := range complete {
+		tx := post.Tx
+		tx.Date, tx.Position, tx.File, tx.Payee = header.Date, header.Position, header.File, header.Payee
+		if tx.State == "" {
+			tx.State = header.State
+		}
+		if tx.Note == "" {
+			tx.Note = header.Note
+		}
+		tx.Tags = header.Tags
+		if len(header.Metadata) > 0 {
+			// Posting metadata takes precedence
+			metadata := make(map[string]string, len(header.Metadata)+len(tx.Metadata))
+			for k, v := range header.Metadata {
+				metadata[k] = v
+			}
+			for k, v := range tx.Metadata {
+				metadata[k] = v
+			}
+			tx.Metadata = metadata
+		}
+		tx.HeaderLine = header.Line
+		if tx.Line == 0 {
+			tx.Line = header.Line
+		}
+		k := [2]string{tx.Account, tx.Commodity}
+		if p.balances[k] == nil {
+			p.balances[k] = new(big.Rat)
+		}
+		p.balances[k].Add(p.balances[k], post.quantity)
+		if reason := skipped(&tx); reason != "" {
+			audit(reason, &tx)
+			continue
+		}
+		p.txs[tx.key()] = append(p.txs[tx.key()], tx)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJournal(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		journal string
+		want    []string
+		err     string
+	}{
+		{"elided amount", `2024/03/01 * (12) Shop  ; :food:
+    Expenses:Food      10,50 €
+    Assets:Bank
+`, []string{
+			"main.ledger:2 2024-03-01 cleared Shop Expenses:Food 10.5 € [food]",
+			"main.ledger:3 2024-03-01 cleared Shop Assets:Bank -10.5 € [food]",
+		}, ""},
+		{"directives", `year 2023
+apply account Personal
+alias Food=Expenses:Food
+03/01 ! Bakery
+    Food      3 EUR
+    ! Assets:Bank  ; :notDup:
+end apply account
+`, []string{
+			"main.ledger:5 2023-03-01 pending Bakery Personal:Expenses:Food 3 EUR []",
+			"main.ledger:6 2023-03-01 pending Bakery Personal:Assets:Bank -3 EUR [notDup]",
+		}, ""},
+		{"automated, periodic and comments", `= /Food/
+    (Budget:Food)  -1
+~ monthly
+    Expenses:Rent  500 EUR
+    Assets:Bank
+comment
+2024/03/01 Hidden
+    Expenses:Food  1 EUR
+    Assets:Bank
+end comment
+2024/03/02 Shop
+    Expenses:Food  2 EUR
+    Assets:Bank   -2 EUR
+`, []string{
+			"main.ledger:12 2024-03-02  Shop Expenses:Food 2 EUR []",
+			"main.ledger:13 2024-03-02  Shop Assets:Bank -2 EUR []",
+		}, ""},
+		{"balance assignment", `2024/03/01 Opening
+    Assets:Bank  100 EUR
+    Equity
+2024/03/02 Shop
+    Assets:Bank  = 90 EUR
+    Expenses:Food
+`, []string{
+			"main.ledger:2 2024-03-01  Opening Assets:Bank 100 EUR []",
+			"main.ledger:3 2024-03-01  Opening Equity -100 EUR []",
+			"main.ledger:5 2024-03-02  Shop Assets:Bank -10 EUR []",
+			"main.ledger:6 2024-03-02  Shop Expenses:Food 10 EUR []",
+		}, ""},
+		{"cost", `2024/03/01 Broker
+    Assets:Stocks  2 ACME @ 100 USD
+    Assets:Cash
+`, []string{
+			"main.ledger:2 2024-03-01  Broker Assets:Stocks 2 ACME []",
+			"main.ledger:3 2024-03-01  Broker Assets:Cash -200 USD []",
+		}, ""},
+		{"two elided amounts", `2024/03/01 Shop
+    Expenses:Food
+    Assets:Bank
+
+2024/03/02 Bakery
+`, nil, "main.ledger:3: only one posting with no amount"},
+		{"invalid date", `2024/13/01 Shop
+    Expenses:Food  1 EUR
+    Assets:Bank
+`, nil, "main.ledger:1"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			txs, err := parseJournal("main.ledger", []byte(c.journal))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describePostings(txs); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got postings\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(c.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseJournalInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.ledger": "include 2024/*.ledger\n",
+		"2024/03.ledger": `2024/03/01 Shop
+    Expenses:Food  2 EUR
+    Assets:Bank
+`,
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o777)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal := filepath.Join(dir, "main.ledger")
+	txs, err := parseJournal(journal, []byte(files["main.ledger"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	included := filepath.Join(dir, "2024", "03.ledger")
+	want := []string{
+		included + ":2 2024-03-01  Shop Expenses:Food 2 EUR []",
+		included + ":3 2024-03-01  Shop Assets:Bank -2 EUR []",
+	}
+	if got := describePostings(txs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got postings %v, want %v", got, want)
+	}
+
+	if _, err := parseJournal(journal, []byte("include main.ledger\n")); err == nil || !strings.Contains(err.Error(), "included recursively") {
+		t.Errorf("got error %v for a journal including itself", err)
+	}
+}
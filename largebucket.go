@@ -0,0 +1,86 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"sort"
+)
+
+var largeBucket = flag.Int("large-bucket", 1000, "warn before searching amounts shared by more than this `number` of postings, 0 for never")
+
+// largeBuckets returns the buckets of txs with more than threshold postings,
+// by commodity and smallest amount, those of overlapping tolerance buckets
+// being different
+func largeBuckets(txs map[amountKey][]Tx, threshold int) (large [][]Tx) {
+	if threshold <= 0 {
+		return nil
+	}
+	for _, bucket := range txs {
+		if len(bucket) > threshold {
+			large = append(large, bucket)
+		}
+	}
+	sort.Slice(large, func(i, j int) bool {
+		a, _ := amountRange(large[i])
+		b, _ := amountRange(large[j])
+		if a.Commodity != b.Commodity {
+			return a.Commodity < b.Commodity
+		}
+		return compareAmounts(a, b) < 0
+	})
+	return large
+}
+
+// amountRange returns the postings of bucket with the smallest and the
+// largest amounts, all in the same commodity
+func amountRange(bucket []Tx) (low, high *Tx) {
+	low, high = &bucket[0], &bucket[0]
+	for i := range bucket {
+		if compareAmounts(&bucket[i], low) < 0 {
+			low = &bucket[i]
+		}
+		if compareAmounts(&bucket[i], high) > 0 {
+			high = &bucket[i]
+		}
+	}
+	return low, high
+}
+
+// warnLargeBuckets warns about the buckets of txs with more than threshold
+// postings, like thousands of 0.00 postings, which take long to search and
+// mostly give duplicates nobody would fix, suggesting flags to skip them
+func warnLargeBuckets(txs map[amountKey][]Tx, threshold int) {
+	hint := "skip them with -min-amount or an amount: rule of the ignore file, or -exclude-account"
+	if amountTolerance.enabled() {
+		hint += ", or lower -amount-tolerance"
+	}
+	for _, bucket := range largeBuckets(txs, threshold) {
+		low, high := amountRange(bucket)
+		attrs := []any{"postings", len(bucket), "amount", low.quantity()}
+		if high.quantity() != low.quantity() {
+			attrs = append(attrs, "to", high.quantity())
+		}
+		if low.Commodity != "" {
+			attrs = append(attrs, "commodity", low.Commodity)
+		}
+		slog.Warn("many postings with the same amount, the search may be slow and the report long; "+hint, attrs...)
+	}
+}
@@ -19,17 +19,30 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"math"
+	"math/big"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"sort"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	"joly.pw/ledger-lint-duplicate/dedupe"
 	"zgo.at/zli"
 )
 
@@ -46,62 +59,74 @@ type Ledger struct {
 		} `xml:"commodity"`
 	} `xml:"commodities"`
 	Accounts struct {
-		Text    string `xml:",chardata"`
-		Account struct {
-			Text         string `xml:",chardata"`
-			ID           string `xml:"id,attr"`
-			Name         string `xml:"name"`
-			Fullname     string `xml:"fullname"`
-			AccountTotal struct {
-				Text   string `xml:",chardata"`
-				Amount struct {
-					Text     string `xml:",chardata"`
-					Quantity string `xml:"quantity"`
-				} `xml:"amount"`
-			} `xml:"account-total"`
-			Account []struct {
-				Text         string `xml:",chardata"`
-				ID           string `xml:"id,attr"`
-				Name         string `xml:"name"`
-				Fullname     string `xml:"fullname"`
-				AccountTotal struct {
-					Text   string `xml:",chardata"`
-					Amount struct {
-						Text     string `xml:",chardata"`
-						Quantity string `xml:"quantity"`
-					} `xml:"amount"`
-				} `xml:"account-total"`
-				Account struct {
-					Text          string `xml:",chardata"`
-					ID            string `xml:"id,attr"`
-					Name          string `xml:"name"`
-					Fullname      string `xml:"fullname"`
-					AccountAmount struct {
-						Text   string `xml:",chardata"`
-						Amount struct {
-							Text     string `xml:",chardata"`
-							Quantity string `xml:"quantity"`
-						} `xml:"amount"`
-					} `xml:"account-amount"`
-					AccountTotal struct {
-						Text   string `xml:",chardata"`
-						Amount struct {
-							Text     string `xml:",chardata"`
-							Quantity string `xml:"quantity"`
-						} `xml:"amount"`
-					} `xml:"account-total"`
-				} `xml:"account"`
-			} `xml:"account"`
-		} `xml:"account"`
+		Text    string       `xml:",chardata"`
+		Account []xmlAccount `xml:"account"`
 	} `xml:"accounts"`
 	Transactions struct {
-		Text        string `xml:",chardata"`
-		Transaction []struct {
-			Text     string `xml:",chardata"`
-			State    string `xml:"state,attr"`
-			Date     string `xml:"date"`
-			Payee    string `xml:"payee"`
-			Note     string `xml:"note"`
+		Text        string        `xml:",chardata"`
+		Transaction []Transaction `xml:"transaction"`
+	} `xml:"transactions"`
+}
+
+// xmlAccount is an account of the <accounts> section, with its sub-accounts
+type xmlAccount struct {
+	Text     string       `xml:",chardata"`
+	ID       string       `xml:"id,attr"`
+	Name     string       `xml:"name"`
+	Fullname string       `xml:"fullname"`
+	Account  []xmlAccount `xml:"account"`
+}
+
+// names adds the full names of a and its sub-accounts to names, by id
+func (a *xmlAccount) names(names map[string]string) {
+	if a.ID != "" && a.Fullname != "" {
+		names[a.ID] = a.Fullname
+	}
+	for i := range a.Account {
+		a.Account[i].names(names)
+	}
+}
+
+// accountNames returns the full names of the accounts of l, by id, to resolve
+// the ref attribute of postings
+func (l *Ledger) accountNames() map[string]string {
+	names := make(map[string]string)
+	for i := range l.Accounts.Account {
+		l.Accounts.Account[i].names(names)
+	}
+	return names
+}
+
+type Transaction struct {
+	Text     string `xml:",chardata"`
+	State    string `xml:"state,attr"`
+	Date     string `xml:"date"`
+	Payee    string `xml:"payee"`
+	Note     string `xml:"note"`
+	Metadata struct {
+		Text  string `xml:",chardata"`
+		Value []struct {
+			Text   string `xml:",chardata"`
+			Key    string `xml:"key,attr"`
+			String string `xml:"string"`
+		} `xml:"value"`
+		Tags []string `xml:"tag"`
+	} `xml:"metadata"`
+	Postings struct {
+		Text    string `xml:",chardata"`
+		Posting []struct {
+			Text    string `xml:",chardata"`
+			State   string `xml:"state,attr"`
+			Virtual string `xml:"virtual,attr"`
+			// Set on postings added by automated transactions, and on
+			// those of periodic ones with --forecast or --budget
+			Generated string `xml:"generated,attr"`
+			Note      string `xml:"note"`
+			Account   struct {
+				Text string `xml:",chardata"`
+				Ref  string `xml:"ref,attr"`
+				Name string `xml:"name"`
+			} `xml:"account"`
 			Metadata struct {
 				Text  string `xml:",chardata"`
 				Value []struct {
@@ -111,83 +136,264 @@ type Ledger struct {
 				} `xml:"value"`
 				Tags []string `xml:"tag"`
 			} `xml:"metadata"`
-			Postings struct {
-				Text    string `xml:",chardata"`
-				Posting []struct {
-					Text    string `xml:",chardata"`
-					State   string `xml:"state,attr"`
-					Virtual string `xml:"virtual,attr"`
-					Account struct {
-						Text string `xml:",chardata"`
-						Ref  string `xml:"ref,attr"`
-						Name string `xml:"name"`
-					} `xml:"account"`
-					PostAmount struct {
-						Text   string `xml:",chardata"`
-						Amount struct {
-							Text     string  `xml:",chardata"`
-							Quantity float64 `xml:"quantity"`
-						} `xml:"amount"`
-					} `xml:"post-amount"`
-					BalanceAssignment struct {
-						Text     string  `xml:",chardata"`
-						Quantity float64 `xml:"quantity"`
-					} `xml:"balance-assignment"`
-					Total struct {
-						Text   string `xml:",chardata"`
-						Amount struct {
-							Text     string  `xml:",chardata"`
-							Quantity float64 `xml:"quantity"`
-						} `xml:"amount"`
-					} `xml:"total"`
-				} `xml:"posting"`
-			} `xml:"postings"`
-		} `xml:"transaction"`
-	} `xml:"transactions"`
+			PostAmount struct {
+				Text   string `xml:",chardata"`
+				Amount struct {
+					Text      string `xml:",chardata"`
+					Commodity struct {
+						Symbol string `xml:"symbol"`
+					} `xml:"commodity"`
+					// Quantity is exact, like the decimals of the journal
+					Quantity string `xml:"quantity"`
+				} `xml:"amount"`
+			} `xml:"post-amount"`
+			BalanceAssignment struct {
+				Text     string  `xml:",chardata"`
+				Quantity float64 `xml:"quantity"`
+			} `xml:"balance-assignment"`
+			BalanceAssertion *struct {
+				Text      string `xml:",chardata"`
+				Commodity struct {
+					Symbol string `xml:"symbol"`
+				} `xml:"commodity"`
+				Quantity float64 `xml:"quantity"`
+			} `xml:"balance-assertion"`
+			Total struct {
+				Text   string `xml:",chardata"`
+				Amount struct {
+					Text     string  `xml:",chardata"`
+					Quantity float64 `xml:"quantity"`
+				} `xml:"amount"`
+			} `xml:"total"`
+		} `xml:"posting"`
+	} `xml:"postings"`
+	// Offset and Position of the transaction in the XML file
+	Offset   int `xml:"-"`
+	Position int `xml:"-"`
+}
+
+// nextTransaction returns the offset of the first <transaction> element of b
+// at or after offset, or -1
+func nextTransaction(b []byte, offset int) int {
+	tag := []byte("<transaction")
+	for offset < len(b) {
+		i := bytes.Index(b[offset:], tag)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		if end := i + len(tag); end < len(b) && bytes.IndexByte([]byte("> \t\r\n/"), b[end]) >= 0 {
+			return i
+		}
+		offset = i + 1
+	}
+	return -1
+}
+
+// decodeLedger decodes the output of `ledger xml`. Transactions are decoded
+// one by one, so that with lenient, malformed ones can be skipped. Their
+// offsets are then returned.
+func decodeLedger(b []byte, lenient bool) (ledger Ledger, skipped []int, err error) {
+	// The document without its transactions, decoded one by one below. An
+	// error here is most likely caused by a malformed transaction, which
+	// is dealt with below too.
+	header := b
+	if first, end := nextTransaction(b, 0), bytes.LastIndex(b, []byte("</transactions>")); first >= 0 && end > first {
+		header = append(append([]byte(nil), b[:first]...), b[end:]...)
+	}
+	docErr := xml.Unmarshal(header, &ledger)
+	ledger.Transactions.Transaction = nil
+
+	endTag := []byte("</transaction>")
+	for start, position := nextTransaction(b, 0), 0; start >= 0; position++ {
+		next := nextTransaction(b, start+1)
+		end := bytes.Index(b[start:], endTag)
+		if end >= 0 {
+			end += start + len(endTag)
+		}
+
+		var tx Transaction
+		var txErr error
+		if end < 0 || (next >= 0 && next < end) {
+			txErr = errors.New("unterminated transaction")
+		} else if txErr = xml.Unmarshal(b[start:end], &tx); txErr == nil {
+			_, txErr = time.Parse("2006/01/02", tx.Date)
+		}
+
+		if txErr != nil {
+			if !lenient {
+				return ledger, nil, fmt.Errorf("transaction at offset %v: %w", start, txErr)
+			}
+			skipped = append(skipped, start)
+		} else {
+			tx.Offset = start
+			tx.Position = position
+			ledger.Transactions.Transaction = append(ledger.Transactions.Transaction, tx)
+		}
+		start = next
+	}
+
+	if docErr != nil && !lenient {
+		return ledger, nil, docErr
+	}
+	return ledger, skipped, nil
 }
 
-func (l *Ledger) toTxs() map[float64][]Tx {
-	txs := make(map[float64][]Tx)
-	for p, txXml := range l.Transactions.Transaction {
+// toTxs returns the postings of l by amount. Generated postings repeat by
+// design and are skipped. Accounts are named by the full name their ref has in
+// accounts, see accountNames, rather than the name of the posting, which may
+// just be the last part of it. Postings without an account or a valid
+// quantity cannot be checked and are dropped, with the offsets of the
+// transactions they belong to returned in dropped.
+func (l *Ledger) toTxs(accounts map[string]string) (txs map[amountKey][]Tx, dropped []int) {
+	txs = make(map[amountKey][]Tx)
+	strs := make(interner)
+	for _, txXml := range l.Transactions.Transaction {
 		date, err := time.Parse("2006/01/02", txXml.Date)
 		if err != nil {
-			log.Fatal(err)
+			fatal("invalid date", "offset", txXml.Offset, "err", err)
 		}
 
-		for _, posting := range txXml.Postings.Posting {
-			amount := posting.PostAmount.Amount.Quantity
+		if len(txXml.Postings.Posting) == 0 {
+			dropped = append(dropped, txXml.Offset)
+		}
+
+		// Shared by the postings of the transaction, and not to be modified
+		var tags []string
+		for _, tag := range txXml.Metadata.Tags {
+			tags = append(tags, strs.intern(tag))
+		}
+		var metadata map[string]string
+		if len(txXml.Metadata.Value) > 0 {
+			metadata = make(map[string]string, len(txXml.Metadata.Value))
+			for _, value := range txXml.Metadata.Value {
+				metadata[strs.intern(value.Key)] = value.String
+			}
+		}
+		payee := strs.intern(txXml.Payee)
 
-			tags := make([]string, len(txXml.Metadata.Tags), len(txXml.Metadata.Tags))
-			copy(tags, txXml.Metadata.Tags)
+		droppedPosting := false
+		for _, posting := range txXml.Postings.Posting {
+			if posting.Generated == "true" {
+				continue
+			}
+			account := accounts[posting.Account.Ref]
+			if account == "" {
+				account = posting.Account.Name
+			}
+			if account == "" {
+				droppedPosting = true
+				continue
+			}
+			quantity, err := parseNumber(strings.TrimSpace(posting.PostAmount.Amount.Quantity))
+			if err != nil {
+				droppedPosting = true
+				continue
+			}
 
 			tx := Tx{
-				Date:     date,
-				Position: p,
-				Payee:    txXml.Payee,
-				Account:  posting.Account.Name,
-				Amount:   amount,
-				Tags:     tags,
+				Tx: dedupe.Tx{
+					Date:      date,
+					Payee:     payee,
+					Account:   strs.intern(account),
+					Commodity: strs.intern(posting.PostAmount.Amount.Commodity.Symbol),
+					Tags:      tags,
+					Metadata:  metadata,
+				},
+				Position: txXml.Position,
+				State:    txXml.State,
+				Note:     txXml.Note,
+			}
+			if posting.State != "" {
+				tx.State = posting.State
 			}
+			if posting.Note != "" {
+				tx.Note = posting.Note
+			}
+			// Posting metadata takes precedence
+			if len(posting.Metadata.Value) > 0 {
+				tx.Metadata = make(map[string]string, len(metadata)+len(posting.Metadata.Value))
+				for k, v := range metadata {
+					tx.Metadata[k] = v
+				}
+				for _, value := range posting.Metadata.Value {
+					tx.Metadata[strs.intern(value.Key)] = value.String
+				}
+			}
+			if len(posting.Metadata.Tags) > 0 {
+				tx.PostingTags = make([]string, 0, len(posting.Metadata.Tags))
+				for _, tag := range posting.Metadata.Tags {
+					tx.PostingTags = append(tx.PostingTags, strs.intern(tag))
+				}
+			}
+			if assertion := posting.BalanceAssertion; assertion != nil {
+				tx.Assertion = &assertion.Quantity
+			}
+			tx.setQuantity(quantity)
+			tx.Quantity = strs.intern(tx.Quantity)
 
-			subTxs, exists := txs[amount]
-			if exists {
-				txs[amount] = append(subTxs, tx)
-			} else {
-				txs[amount] = []Tx{tx}
+			if reason := skipped(&tx); reason != "" {
+				audit(reason, &tx)
+				continue
 			}
+			txs[tx.key()] = append(txs[tx.key()], tx)
+		}
+		if droppedPosting {
+			dropped = append(dropped, txXml.Offset)
 		}
 	}
-	return txs
+	return txs, dropped
+}
+
+// An interner returns a single copy of equal strings, for the many postings
+// to the same accounts to share it
+type interner map[string]string
+
+func (in interner) intern(s string) string {
+	if i, exists := in[s]; exists {
+		return i
+	}
+	in[s] = s
+	return s
 }
 
 type Tx struct {
-	Date time.Time
+	// The posting as matchers of the dedupe package see it: its date,
+	// payee, account, amount, commodity, file and line, tags and metadata
+	dedupe.Tx
 	// Position in the imported xml file
-	Position int
-	Payee    string
-	Account  string
-	Amount   float64
-	Tags     []string
+	Position int `json:"position"`
+	// HeaderLine is the line of the transaction of the posting in File,
+	// when known
+	HeaderLine int `json:"-"`
+	// Input file, when there are several
+	Input string `json:"input,omitempty"`
+	// Quantity is the exact decimal of Amount, see setQuantity, and what it
+	// is written as in JSON
+	Quantity string `json:"-"`
+	// PostingTags are the tags of the posting itself
+	PostingTags []string `json:"posting_tags,omitempty"`
+	// Assertion is the balance of Account asserted with the posting, if any
+	Assertion *float64 `json:"assertion,omitempty"`
+	// State is cleared, pending or empty, for the posting or else its
+	// transaction
+	State string `json:"state,omitempty"`
+	// Note of the posting or else its transaction, tags and metadata
+	// included
+	Note string `json:"note,omitempty"`
+	// Postings of the transaction, with -granularity transaction only
+	Postings []Posting `json:"postings,omitempty"`
+}
+
+// mark returns the ledger mark of the state of tx, with a space after it
+func (tx *Tx) mark() string {
+	switch tx.State {
+	case "cleared":
+		return "* "
+	case "pending":
+		return "! "
+	}
+	return ""
 }
 
 // Find returns true on the first encountered occurence of val in slice
@@ -200,120 +406,1079 @@ func find(val string, slice []string) bool {
 	return false
 }
 
-func printDuplicate(ignoredTag string, txs ...*Tx) {
+func printGroup(title string, ignoredTag string, txs ...*Tx) {
 	if len(txs) <= 0 {
 		return
 	}
 
-	fmt.Print(zli.BrightBlack|zli.White.Bg(), "; Potential duplicates:", zli.Reset, "\n")
+	fmt.Print(zli.BrightBlack|zli.White.Bg(), "; ", title, ":", zli.Reset, "\n")
 	for _, tx := range txs {
 		var tagIndicator string
 		if find(ignoredTag, tx.Tags) {
 			tagIndicator = fmt.Sprint(zli.Blue, "[IGNORED]", zli.Reset)
 		}
 
-		fmt.Printf("(%v)\t%v %v\t\t\t%v\n\t\t%v\t\t\t%v\n",
-			tx.Position, tx.Date.Format("2006-01-02"), tx.Payee, tagIndicator,
+		if tx.Postings != nil {
+			fmt.Printf("(%v)\t%v %v%v\t\t\t%v\n", tx.position(), tx.Date.Format("2006-01-02"), tx.mark(), tx.Payee, tagIndicator)
+			for _, p := range tx.Postings {
+				fmt.Printf("\t\t%v\t\t\t%v %v\n", p.Account, p.Amount, p.Commodity)
+			}
+			continue
+		}
+		fmt.Printf("(%v)\t%v %v%v\t\t\t%v\n\t\t%v\t\t\t%v\n",
+			tx.position(), tx.Date.Format("2006-01-02"), tx.mark(), tx.Payee, tagIndicator,
 			tx.Account, tx.Amount)
 	}
 }
 
-// maxDuration is in hours
-func findDuplicates(maxDuration float64, ignoredTag string, txs map[float64][]Tx) (allDuplicates [][]*Tx) {
-	// Add duplicates, unles all transactions are marked with the ignore tag
-	keep := func(duplicates []*Tx) {
-		// If all duplicates have the ignore tag, drop them
-		for _, tx := range duplicates {
-			if !find(ignoredTag, tx.Tags) {
-				allDuplicates = append(allDuplicates, duplicates)
-				return
+// position returns where tx is, as printed by printGroup
+func (tx *Tx) position() string {
+	if tx.File != "" {
+		return fmt.Sprintf("%v:%v", tx.File, tx.Line)
+	} else if tx.Input != "" {
+		return fmt.Sprintf("%v %v", tx.Input, tx.Position)
+	}
+	return fmt.Sprint(tx.Position)
+}
+
+// fingerprint identifies a group of postings by their dates, payees,
+// accounts and amounts, whatever their order and position in the files
+func fingerprint(txs ...*Tx) string {
+	keys := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		keys = append(keys, fmt.Sprintf("%v\x00%v\x00%v\x00%v", tx.Date.Format("2006-01-02"), tx.Payee, tx.Account, tx.quantity()))
+	}
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\x00")))
+	return hex.EncodeToString(sum[:6])
+}
+
+// sortGroups sorts groups by the date and amount of their first posting, then
+// by fingerprint, for reports not to depend on the order buckets are searched
+func sortGroups(groups [][]*Tx) {
+	fingerprints := make(map[*Tx]string, len(groups))
+	for _, g := range groups {
+		fingerprints[g[0]] = fingerprint(g...)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i][0], groups[j][0]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if c := compareAmounts(a, b); c != 0 {
+			return c < 0
+		}
+		return fingerprints[a] < fingerprints[b]
+	})
+}
+
+// toleranceBuckets returns the postings of txs in overlapping buckets, for
+// only postings with close amounts in the same commodity to be compared. Amounts are rounded down to
+// cells as wide as t and each bucket holds the postings of a cell and of the
+// next one, so that any two postings within t share a bucket without chains
+// of close amounts merging into one large bucket. Groups found in several
+// buckets are then joined by mergeGroups.
+//
+// With a relative tolerance, cells are those of the logarithm of amounts,
+// positive and negative amounts apart, for amounts within t to have
+// logarithms at most -log(1-t) apart. Zero amounts are only duplicates of
+// each other.
+func toleranceBuckets(txs map[amountKey][]Tx, t tolerance) map[amountKey][]Tx {
+	// Cells are numbered, each bucket holding cell n and cell n+step
+	step := big.NewInt(1)
+	cell := func(q *big.Rat) *big.Int {
+		quo := new(big.Rat).Quo(q, t.exact)
+		// Euclidean division, by a positive denominator, rounds down
+		return new(big.Int).Div(quo.Num(), quo.Denom())
+	}
+	if t.relative {
+		// Logarithms only choose buckets, amountWithin comparing amounts
+		// exactly, so cells are a little wider for rounding errors not to
+		// set apart amounts within t
+		width := -math.Log(1-toFloat(t.exact)) + amountEpsilon
+		step = big.NewInt(2)
+		// Even cells for positive amounts, odd ones for negative ones
+		cell = func(q *big.Rat) *big.Int {
+			amount := toFloat(q)
+			c := 2 * int64(math.Floor(math.Log(math.Abs(amount))/width))
+			if amount < 0 {
+				c++
 			}
+			return big.NewInt(c)
 		}
 	}
-
-	for _, txs := range txs {
-		if len(txs) <= 1 {
+	type cellPostings struct {
+		n         *big.Int
+		commodity string
+		postings  []Tx
+	}
+	// Cells of different commodities are apart, like buckets
+	cells := make(map[amountKey]*cellPostings)
+	// Buckets are keyed by their first cell
+	buckets := make(map[amountKey][]Tx)
+	for k, bucket := range txs {
+		q := bucket[0].exact()
+		if t.relative && q.Sign() == 0 {
+			if len(bucket) > 1 {
+				buckets[k] = bucket
+			}
 			continue
 		}
+		n := cell(q)
+		k := newAmountKey("cell"+n.String(), bucket[0].Commodity)
+		c, exists := cells[k]
+		if !exists {
+			c = &cellPostings{n: n, commodity: bucket[0].Commodity}
+			cells[k] = c
+		}
+		c.postings = append(c.postings, bucket...)
+	}
+	for k, c := range cells {
+		var next []Tx
+		if n, exists := cells[newAmountKey("cell"+new(big.Int).Add(c.n, step).String(), c.commodity)]; exists {
+			next = n.postings
+		}
+		if len(c.postings)+len(next) > 1 {
+			buckets[k] = append(append([]Tx(nil), c.postings...), next...)
+		}
+	}
+	return buckets
+}
 
-		sort.SliceStable(txs, func(i, j int) bool {
-			return txs[i].Date.Before(txs[j].Date)
+// mergeGroups joins the groups sharing a posting, as found in overlapping
+// buckets, with their postings sorted like bucketDuplicates does
+func mergeGroups(groups [][]*Tx) (merged [][]*Tx) {
+	// The same posting is copied in each bucket it is in
+	type key struct {
+		input, account string
+		position       int
+		amount         string
+	}
+	first := make(map[key]int)
+	parent := make([]int, len(groups))
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	for i, g := range groups {
+		parent[i] = i
+		for _, tx := range g {
+			k := key{tx.Input, tx.Account, tx.Position, tx.quantity()}
+			if j, exists := first[k]; exists {
+				parent[root(i)] = root(j)
+			} else {
+				first[k] = i
+			}
+		}
+	}
+
+	byRoot := make(map[int][]*Tx)
+	var roots []int
+	seen := make(map[key]bool)
+	for i, g := range groups {
+		r := root(i)
+		if _, exists := byRoot[r]; !exists {
+			roots = append(roots, r)
+		}
+		for _, tx := range g {
+			k := key{tx.Input, tx.Account, tx.Position, tx.quantity()}
+			if !seen[k] {
+				seen[k] = true
+				byRoot[r] = append(byRoot[r], tx)
+			}
+		}
+	}
+	for _, r := range roots {
+		g := byRoot[r]
+		sort.SliceStable(g, func(i, j int) bool {
+			if !g[i].Date.Equal(g[j].Date) {
+				return g[i].Date.Before(g[j].Date)
+			}
+			if g[i].Input != g[j].Input {
+				return g[i].Input < g[j].Input
+			}
+			if g[i].Position != g[j].Position {
+				return g[i].Position < g[j].Position
+			}
+			// Groups come in any order
+			if c := compareAmounts(g[i], g[j]); c != 0 {
+				return c < 0
+			}
+			return g[i].Account < g[j].Account
 		})
+		merged = append(merged, g)
+	}
+	return merged
+}
 
-		var duplicates []*Tx
-		lastInserted := -1
-		for i := 1; i < len(txs); i++ {
-			endDate := txs[i].Date
-			d := txs[i].Date.Sub(txs[i-1].Date)
-			if d.Hours() <= maxDuration {
-				if d.Hours() < 0 {
-					log.Fatal("negative duration 1, this is a bug, please report it!")
-				}
-				if lastInserted >= 0 && endDate.Sub(duplicates[lastInserted].Date).Hours() <= maxDuration {
-					if endDate.Sub(duplicates[lastInserted].Date).Hours() < 0 {
-						log.Fatal("negative duration 2, this is a bug, please report it!")
-					}
-					duplicates = append(duplicates, &txs[i])
-					lastInserted++
-				} else {
-					keep(duplicates)
-					duplicates = []*Tx{&txs[i-1], &txs[i]}
-					lastInserted = 1
-				}
+// findDuplicates searches each bucket of txs for duplicates, with jobs
+// buckets searched in parallel. Reviewed groups are left to dropReviewed.
+func findDuplicates(jobs int, match Matcher, window int, ignoredTag string, txs map[amountKey][]Tx) (allDuplicates [][]*Tx) {
+	buckets := make(chan []Tx)
+	results := make(chan [][]*Tx)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bucket := range buckets {
+				results <- bucketDuplicates(match, window, ignoredTag, bucket)
 			}
+		}()
+	}
+	go func() {
+		for _, bucket := range txs {
+			buckets <- bucket
 		}
+		close(buckets)
+		wg.Wait()
+		close(results)
+	}()
 
-		keep(duplicates)
+	for duplicates := range results {
+		allDuplicates = append(allDuplicates, duplicates...)
 	}
 	return allDuplicates
 }
 
+// bucketDuplicates returns the duplicates among bucket: groups of postings
+// each matching another one of the group, at most window days apart. Postings are
+// sorted by date and each one is compared to the previous ones in the window.
+func bucketDuplicates(match Matcher, window int, ignoredTag string, bucket []Tx) (allDuplicates [][]*Tx) {
+	// Postings with the ignore tag are not checked at all, whatever the
+	// other postings of their transaction
+	txs := bucket[:0:0]
+	for _, tx := range bucket {
+		if !find(ignoredTag, tx.PostingTags) {
+			txs = append(txs, tx)
+		}
+	}
+	if len(txs) <= 1 {
+		return nil
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool {
+		if !txs[i].Date.Equal(txs[j].Date) {
+			return txs[i].Date.Before(txs[j].Date)
+		}
+		if txs[i].Input != txs[j].Input {
+			return txs[i].Input < txs[j].Input
+		}
+		return txs[i].Position < txs[j].Position
+	})
+
+	// Groups are the connected components of the matches, kept as a
+	// union-find forest
+	parent := make([]int, len(txs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	start := 0
+	for i := range txs {
+		for daysApart(txs[start].Date, txs[i].Date) > window {
+			start++
+		}
+		for j := start; j < i; j++ {
+			if match(&txs[j], &txs[i]) {
+				parent[root(i)] = root(j)
+			}
+		}
+	}
+
+	// In the order of their first posting, by date
+	groups := make(map[int][]*Tx)
+	var roots []int
+	for i := range txs {
+		r := root(i)
+		if _, exists := groups[r]; !exists {
+			roots = append(roots, r)
+		}
+		groups[r] = append(groups[r], &txs[i])
+	}
+	for _, r := range roots {
+		if len(groups[r]) > 1 {
+			allDuplicates = append(allDuplicates, groups[r])
+		}
+	}
+	return allDuplicates
+}
+
+// dropReviewed returns groups without those whose postings all have the
+// ignore tag or were reviewed
+func dropReviewed(ignoredTag string, groups [][]*Tx) (kept [][]*Tx) {
+	for _, g := range groups {
+		reviewed := true
+		for _, tx := range g {
+			reviewed = reviewed && (find(ignoredTag, tx.Tags) || tx.Meta(reviewedKey) != "")
+		}
+		if reviewed {
+			auditGroup("all postings have the ignore tag or were reviewed", "duplicate", g)
+			continue
+		}
+		kept = append(kept, g)
+	}
+	return kept
+}
+
+// dropCleared returns groups without those whose postings are all cleared,
+// as both sides of such a pair were reconciled against the bank already.
+func dropCleared(groups [][]*Tx) (kept [][]*Tx) {
+	for _, g := range groups {
+		cleared := true
+		for _, tx := range g {
+			cleared = cleared && tx.State == "cleared"
+		}
+		if cleared {
+			auditGroup("all postings are cleared, with -hide-cleared-pairs", "duplicate", g)
+			continue
+		}
+		kept = append(kept, g)
+	}
+	return kept
+}
+
+// splitArgs splits s into arguments like a shell would, honouring single and
+// double quotes and backslash escapes.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// loadTxs reads the transactions of fileName, which holds either the output
+// of `ledger xml` or `ledger emacs`. Other files are treated as journals and
+// exported by running `ledger xml` on them. See decodeLedger for lenient.
+func loadTxs(fileName string, ledgerArgs string, lenient bool) (map[amountKey][]Tx, error) {
+	b, err := readInput(fileName)
+	if err != nil {
+		return nil, err
+	}
+	switch content := strings.TrimSpace(string(b)); {
+	case strings.HasPrefix(content, "("):
+		return parseEmacs(fileName, b)
+	case isRegister(b):
+		return parseRegister(fileName, b)
+	case strings.HasPrefix(content, "["):
+		return parseHledger(fileName, b)
+	case isBeancount(fileName):
+		return parseBeancount(fileName, b)
+	case isCSV(fileName):
+		return parseCSV(fileName, b)
+	case !strings.HasPrefix(content, "<") && nativeParser():
+		return parseJournal(fileName, b)
+	case !strings.HasPrefix(content, "<") && *parser == "register":
+		if b, err = exportRegister(fileName, ledgerArgs); err != nil {
+			return nil, err
+		}
+		return parseRegister(fileName, b)
+	case !strings.HasPrefix(content, "<") && *parser == "hledger":
+		if b, err = exportWith("hledger", fileName, ledgerArgs, "print", "-O", "json"); err != nil {
+			return nil, err
+		}
+		return parseHledger(fileName, b)
+	case !strings.HasPrefix(content, "<"):
+		b, err = exportXML(fileName, ledgerArgs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ledger, skipped, err := decodeLedger(b, lenient)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", fileName, err)
+	}
+	if len(skipped) > 0 {
+		slog.Warn("skipped malformed transactions", "file", fileName, "count", len(skipped), "offsets", skipped)
+	}
+
+	txs, dropped := ledger.toTxs(ledger.accountNames())
+	if len(dropped) > 0 {
+		seen := len(ledger.Transactions.Transaction) + len(skipped)
+		slog.Warn("transactions have postings that could not be read (unexpected XML schema?) and were not checked",
+			"file", fileName, "count", len(dropped), "total", seen, "offsets", dropped)
+	}
+	return txs, nil
+}
+
+// stdinFile is the file name standing for stdin
+const stdinFile = "-"
+
+var stdin struct {
+	once sync.Once
+	b    []byte
+	err  error
+}
+
+// readInput returns the content of the input fileName, read from stdin for
+// stdinFile, once
+func readInput(fileName string) ([]byte, error) {
+	if fileName != stdinFile {
+		return ioutil.ReadFile(fileName)
+	}
+	stdin.once.Do(func() {
+		stdin.b, stdin.err = io.ReadAll(os.Stdin)
+	})
+	return stdin.b, stdin.err
+}
+
+// exportXML runs `ledger xml` on the journal fileName
+func exportXML(fileName string, ledgerArgs string) ([]byte, error) {
+	return export(fileName, ledgerArgs, "xml")
+}
+
+// export runs `ledger command` on the journal fileName
+func export(fileName string, ledgerArgs string, command ...string) ([]byte, error) {
+	return exportWith("ledger", fileName, ledgerArgs, command...)
+}
+
+// exportWith runs `program command` on the journal fileName, program being
+// ledger or hledger
+func exportWith(program string, fileName string, ledgerArgs string, command ...string) ([]byte, error) {
+	extra, err := splitArgs(ledgerArgs)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"-f", fileName}, extra...)
+	args = append(args, command...)
+	cmd := exec.Command(program, args...)
+	cmd.Stderr = os.Stderr
+	if fileName == stdinFile {
+		b, err := readInput(fileName)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdin = bytes.NewReader(b)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running %v %v: %w", program, strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// expandFileSet returns the files matching pattern, where %Y stands for any
+// year, in chronological order
+func expandFileSet(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(strings.ReplaceAll(pattern, "%Y", "[0-9][0-9][0-9][0-9]"))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no file matches %v", pattern)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// uniqueFiles removes files given more than once, for instance both by name
+// and through a file set, as they would otherwise all be duplicates
+func uniqueFiles(fileNames []string) (unique []string) {
+	seen := make(map[string]bool)
+	for _, fileName := range fileNames {
+		key := filepath.Clean(fileName)
+		if abs, err := filepath.Abs(fileName); err == nil {
+			key = abs
+		}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, fileName)
+		}
+	}
+	return unique
+}
+
+// input holds what was read from one input file
+type input struct {
+	fileName string
+	txs      map[amountKey][]Tx
+	entries  []timeEntry
+	err      error
+}
+
+// loadFiles reads fileNames with up to jobs of them read in parallel,
+// returning them in the same order
+func loadFiles(jobs int, ledgerArgs string, lenient bool, fileNames []string) []input {
+	inputs := make([]input, len(fileNames))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, fileName := range fileNames {
+		inputs[i].fileName = fileName
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(in *input) {
+			defer func() { <-sem; wg.Done() }()
+			if !isTimeFile(in.fileName) {
+				in.txs, in.err = loadTxs(in.fileName, ledgerArgs, lenient)
+				return
+			}
+			b, err := ioutil.ReadFile(in.fileName)
+			if err != nil {
+				in.err = err
+				return
+			}
+			in.entries, in.err = parseTimeFile(in.fileName, b)
+		}(&inputs[i])
+	}
+	wg.Wait()
+	return inputs
+}
+
+var configPath = flag.String("config", defaultConfig, "read settings from `file`, with lines like \"days = 5\"")
+var preHook = flag.String("pre-hook", "", "shell `command` run before reading inputs, like regenerating an XML export")
+var postHook = flag.String("post-hook", "", "shell `command` run after the report, with the number of findings in $LEDGER_LINT_DUPLICATE_FINDINGS")
+var logFormat = flag.String("log-format", "text", "format of diagnostics on stderr: text or json")
+var logLevel = flag.String("log-level", "info", "minimum `level` of diagnostics: debug, info, warn or error")
+
+// mergeInputs puts the transactions of all inputs in the same buckets, so
+// that duplicates are found across files too, like at the turn of the year
+// with one file per year
+func mergeInputs(inputs []input) (txs map[amountKey][]Tx, entries []timeEntry, err error) {
+	if len(inputs) == 1 && inputs[0].txs != nil {
+		return inputs[0].txs, inputs[0].entries, inputs[0].err
+	}
+	txs = make(map[amountKey][]Tx)
+	for _, input := range inputs {
+		if input.err != nil {
+			return nil, nil, input.err
+		}
+		entries = append(entries, input.entries...)
+		for amount, subTxs := range input.txs {
+			if len(inputs) > 1 {
+				for i := range subTxs {
+					subTxs[i].Input = input.fileName
+				}
+			}
+			txs[amount] = append(txs[amount], subTxs...)
+		}
+	}
+	return txs, entries, nil
+}
+
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
 var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
 var days = flag.Float64("days", 10, "time in days to take before and after for two transactions to be considered duplicate")
+var inclusive = flag.Bool("inclusive", true, "with -days 10, transactions exactly 10 days apart may be duplicates; -inclusive=false for them not to")
+
+func init() {
+	flag.Var(daysFlag{days}, "window", "`days` like 10d, as -days")
+}
+
+var amountTolerance tolerance
+
+func init() {
+	flag.Var(&amountTolerance, "amount-tolerance", "largest difference between the amounts of two transactions to be considered duplicate, like 0.5, or percentage of the largest amount, like 1%")
+}
+
 var ignoredTag = flag.String("ignore-tag", "notDup", "ignore these tags when all duplicates transactions have it")
+var ignoredMetadata = flag.String("ignore-metadata", "not-duplicate", "never report transactions or postings with this metadata `key`, unless its value is false, no or 0")
+var streamPath = flag.String("stream", "", "after loading the ledger, check candidate transactions read from this `file`, named pipe, unix:socket, http:address or queue:directory")
+var streamTokens = flag.String("stream-tokens", "", "comma separated `tokens`, one of which HTTP clients of -stream must send as \"Authorization: Bearer token\"")
+var streamRateLimit = flag.Int("stream-rate-limit", 0, "maximum `requests` per minute for each HTTP client of -stream (by token, or address without tokens), 0 for no limit")
+var fileSet = flag.String("file-set", "", "also read all files matching `pattern`, where %Y stands for a year, like ledger-%Y.journal")
+var timeWindow = flag.Duration("time-window", 0, "maximum `duration` between two postings with their time of day in time: metadata for them to be duplicates, and to be removed by -fix remove even with different payees; 0 to ignore times")
+var matchers = flag.String("matchers", "window", "comma separated matching `strategies` that must all agree: exact, window, fuzzy-payee, fitid")
+var scriptPath = flag.String("script", "", "Starlark `file` defining keep(tx) to filter transactions and/or similar(a, b) to compare them")
+var scriptThreshold = flag.Float64("script-threshold", 0.5, "minimum value of similar(a, b) from -script for a and b to be duplicates")
+var workspaces = workspaceFlag{}
+
+func init() {
+	flag.Var(workspaces, "workspace", "with -stream, also serve the ledger configured in `name=file`, where file sets file-set and other settings; repeatable")
+}
+
+var jobs = flag.Int("jobs", runtime.NumCPU(), "number of files read and of amounts searched in parallel")
+var hideClearedPairs = flag.Bool("hide-cleared-pairs", false, "do not report duplicates whose postings are all cleared")
+var ci = flag.Bool("ci", false, "exit with status 1 when duplicates are reported, like -max-duplicates 0")
+var maxDuplicates = flag.Int("max-duplicates", -1, "exit with status 1 when more than `n` groups of duplicates are reported, -1 for no limit")
+var payeeThreshold = flag.Float64("payee-threshold", 0.8, "minimum `similarity` of payees, from 0 to 1, for fuzzy-payee; setting it adds fuzzy-payee to -matchers")
+var lenient = flag.Bool("lenient", false, "skip malformed transactions in XML input instead of failing")
+var ledgerArgs = flag.String("ledger-args", "", "extra `arguments` passed to ledger when exporting a journal to XML")
+
+// usage prints how to run the program, and its flags, to stderr
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage:\n")
+	fmt.Fprintf(w, "  %v [flags] [--] file...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(w, "  %v [flags] validate file...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(w, "  %v [flags] state list | state set <state> <fingerprint>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(w, "  %v [flags] fuzz-corpus export [-o dir] file...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(w, "  %v [flags] query [date payee amount] file...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(w, "\nWith no file, the input is read from stdin when piped into.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// usageError reports that the program was run wrong, with its usage, and
+// exits with status 2 like for an unknown flag
+func usageError(msg string) {
+	fmt.Fprintf(flag.CommandLine.Output(), "%v\n\n", msg)
+	flag.Usage()
+	os.Exit(2)
+}
 
 func main() {
+	start := time.Now()
+	flag.Usage = usage
 	flag.Parse()
+	if err := setupLogging(*logFormat, *logLevel); err != nil {
+		fatal(err.Error())
+	}
+	onCommandLine := commandLineFlags(flag.CommandLine)
+	if err := loadConfig(*configPath, flag.CommandLine, onCommandLine, onCommandLine["config"]); err != nil {
+		if *configPath != defaultConfig || !errors.Is(err, os.ErrNotExist) {
+			fatal(err.Error())
+		}
+	}
+	// The configuration may have changed them
+	if err := setupLogging(*logFormat, *logLevel); err != nil {
+		fatal(err.Error())
+	}
+
+	if *explainRule != "" {
+		printRule(*explainRule)
+		return
+	}
 
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
-			log.Fatal("could not create CPU profile: ", err)
+			fatal("could not create CPU profile", "err", err)
 		}
 		defer f.Close() // error handling omitted for example
 		if err := pprof.StartCPUProfile(f); err != nil {
-			log.Fatal("could not start CPU profile: ", err)
+			fatal("could not start CPU profile", "err", err)
 		}
 		defer pprof.StopCPUProfile()
 	}
 
-	// TODO Support multiple flag names
+	// After --, arguments are files whatever their names
+	command := flag.Arg(0)
+	if flag.NArg() > 0 && len(os.Args) > flag.NArg() && os.Args[len(os.Args)-flag.NArg()-1] == "--" {
+		command = ""
+	}
+
+	if command == "validate" {
+		if flag.NArg() < 2 {
+			usageError("validate needs at least one file")
+		}
+		if !validateFiles(*ledgerArgs, flag.Args()[1:]...) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if command == "state" {
+		if err := stateCommand(*statePath, flag.Args()[1:]); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+
+	if command == "fuzz-corpus" {
+		if err := fuzzCorpus(flag.Args()[1:], *ledgerArgs); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+
+	if err := runHook(*preHook); err != nil {
+		fatal(err.Error())
+	}
+
 	fileNames := flag.Args()
-	fileName := fileNames[0]
-	b, err := ioutil.ReadFile(fileName)
+	if *fileSet != "" {
+		set, err := expandFileSet(*fileSet)
+		if err != nil {
+			fatal(err.Error())
+		}
+		fileNames = append(fileNames, set...)
+	}
+	fileNames = withCandidate(fileNames, *basePath, *candidatePath)
+	if *jobs < 1 {
+		fatal("-jobs must be at least 1")
+	}
+	if *payeeThreshold < 0 || *payeeThreshold > 1 {
+		fatal("-payee-threshold must be between 0 and 1")
+	}
+	if *granularity != "posting" && *granularity != "transaction" {
+		fatal("unknown granularity, expected posting or transaction", "granularity", *granularity)
+	}
+	if *granularity == "transaction" && amountTolerance.enabled() {
+		// Duplicate transactions have the same postings, amounts included
+		fatal("-granularity transaction compares the amounts of all postings exactly, it cannot be used with -amount-tolerance")
+	}
+	var userScript *script
+	if *scriptPath != "" {
+		var err error
+		if userScript, err = loadScript(*scriptPath); err != nil {
+			fatal(err.Error())
+		}
+	}
+	match, err := scanMatcher(windowDays(*days), userScript)
+	if err != nil {
+		fatal(err.Error())
+	}
+	if *auditFile != "" {
+		if err := openAudit(*auditFile); err != nil {
+			fatal(err.Error())
+		}
+	}
+	ignored, rules, err := loadIgnored(*ignoreFile)
+	if err != nil {
+		fatal(err.Error())
+	}
+	// The stream applies the rules when checking, for reloads to change them
+	if *streamPath == "" {
+		ignoreRules = rules
+	}
+
+	if command == "query" {
+		duplicate, err := queryCommand(match, flag.Args()[1:])
+		if err != nil {
+			fatal(err.Error())
+		}
+		if duplicate {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(fileNames) == 0 {
+		// Piped in, like ledger xml | ledger-lint-duplicate
+		if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice != 0 {
+			usageError("no input file given")
+		}
+		fileNames = []string{stdinFile}
+	}
+	if *fix != "" && containsString(fileNames, stdinFile) {
+		fatal("-fix rewrites journals, they cannot be read from stdin")
+	}
+	if *sinceRef == stdinFile && containsString(fileNames, stdinFile) {
+		fatal("-since-ref reads the diff from stdin, journals cannot be read from it too")
+	}
+	printReport, err := reportFormat(*format)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err.Error())
+	}
+	switch *fix {
+	case "", "merge":
+	case "remove":
+		if *output == "" || len(fileNames) != 1 {
+			fatal("-fix remove needs one journal and -output")
+		}
+	default:
+		fatal("unknown fix mode, expected merge or remove", "fix", *fix)
+	}
+
+	if len(notifiers()) > 0 && *statePath == "" && *baselinePath == "" {
+		fatal("notifications are about findings new since the last run, they need -state or -assert-no-new")
+	}
+	if sample < 1 && (*fix != "" || *statePath != "") {
+		fatal("-sample only finds some duplicates, it cannot be used with -fix or -state")
+	}
+	if *statePath != "" && (*sinceRef != "" || *candidatePath != "" || !begin.IsZero() || !end.IsZero() || onlyAccounts.Regexp != nil || excludedAccounts.Regexp != nil) {
+		fatal("-state marks the findings not found anymore as fixed, it cannot be used with -since-ref, -candidate, -begin, -end, -account or -exclude-account, which leave some out")
+	}
+
+	window := windowDays(*days)
+	var duplicates [][]*Tx
+	var txs map[amountKey][]Tx
+	var entries []timeEntry
+	disk := onDisk(fileNames, *spillThreshold)
+	if disk {
+		if *streamPath != "" || *fix != "" || amountTolerance.enabled() || *baselinePath != "" || sample < 1 || *exportPairs != "" || *indexPath != "" || *granularity != "posting" || *candidatePath != "" || *sinceRef != "" {
+			fatal("inputs are larger than -spill-threshold, -stream, -fix, -amount-tolerance, -assert-no-new, -sample, -export-pairs, -write-index, -granularity transaction, -candidate and -since-ref need them in memory")
+		}
+		slog.Info("inputs are larger than -spill-threshold, only searching duplicates, on disk")
+		if duplicates, err = diskDuplicates(fileNames, match, window, *ignoredTag); err != nil {
+			fatal(err.Error())
+		}
+	} else {
+		inputs := loadFiles(*jobs, *ledgerArgs, *lenient, fileNames)
+		if *fix != "" || *baselinePath != "" || *sinceRef != "" {
+			for i := range inputs {
+				if err := locateTxs(&inputs[i], *ledgerArgs); err != nil {
+					fatal(err.Error())
+				}
+			}
+		}
+		if txs, entries, err = mergeInputs(inputs); err != nil {
+			fatal(err.Error())
+		}
+	}
+
+	if *indexPath != "" {
+		if err := writeIndex(*indexPath, window, txs); err != nil {
+			fatal(err.Error())
+		}
+	}
+	if *streamPath != "" {
+		if err := streamWithReload(txs, onCommandLine); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+
+	all := allTxs(txs)
+	var newLines addedLines
+	if *sinceRef != "" {
+		if newLines, err = loadAddedLines(*sinceRef, all); err != nil {
+			fatal(err.Error())
+		}
+	}
+	if *ignoredMetadata != "" {
+		for _, tx := range all {
+			if optedOut(tx, *ignoredMetadata) {
+				audit("metadata "+*ignoredMetadata+" of -ignore-metadata", tx)
+			}
+		}
+	}
+	violations := checkPolicies(*ignoredTag, all)
+	subscriptions := findSubscriptionDuplicates(*subscriptionTag, splitList(*subscriptionPayees), *ignoredTag, all)
+	var aliasProblems []finding
+	if *checkAliasFlag {
+		aliasProblems, err = checkAliases(fileNames)
+		if err != nil {
+			fatal(err.Error())
+		}
 	}
 
-	var ledger Ledger
-	xml.Unmarshal(b, &ledger)
+	if *strict {
+		var accounts, commodities []string
+		err = readJournals(fileNames, func(fileName string, b []byte) {
+			a, c := journalDeclarations(b)
+			accounts = append(accounts, a...)
+			commodities = append(commodities, c...)
+		})
+		if err != nil {
+			fatal(err.Error())
+		}
+		violations = append(violations, checkDeclared(accounts, commodities, *ignoredTag, all)...)
+	}
 
-	txs := ledger.toTxs()
-	duplicates := findDuplicates(24.**days, *ignoredTag, txs)
-	for _, d := range duplicates {
-		printDuplicate(*ignoredTag, d...)
+	if userScript != nil {
+		if err := userScript.filter(txs); err != nil {
+			fatal(err.Error())
+		}
+	}
+
+	searched := txs
+	if *granularity == "transaction" {
+		searched = byTransaction(txs)
+		match = allOf(samePostings, match)
+	}
+	if amountTolerance.enabled() {
+		searched = toleranceBuckets(txs, amountTolerance)
+		match = allOf(match, amountWithin(amountTolerance))
+	}
+	if *exportPairs != "" {
+		if err := writePairs(*exportPairs, match, window, *ignoredTag, searched); err != nil {
+			fatal(err.Error())
+		}
+	}
+	if !disk {
+		if *candidatePath != "" {
+			searched = candidateBuckets(*candidatePath, searched)
+		}
+		report := func([][]*Tx) {}
+		if sample < 1 {
+			searched, report = sampleSearch(searched)
+		}
+		warnLargeBuckets(searched, *largeBucket)
+		duplicates = findDuplicates(*jobs, match, window, *ignoredTag, searched)
+		if amountTolerance.enabled() {
+			duplicates = mergeGroups(duplicates)
+		}
+		duplicates = dropReviewed(*ignoredTag, duplicates)
+		report(duplicates)
+	}
+	if *hideClearedPairs {
+		duplicates = dropCleared(duplicates)
+	}
+	if !*noRecurringFilter {
+		duplicates = dropRecurring(all, duplicates)
+	}
+	duplicates = dropIgnored(ignored, duplicates)
+	if *candidatePath != "" {
+		duplicates = candidateGroups(*candidatePath, duplicates)
+	}
+	if newLines != nil {
+		duplicates = addedGroups(newLines, duplicates)
+	}
+	sortGroups(duplicates)
+	timeDuplicates, overlaps := findTimeDuplicates(entries)
+	var findings []finding
+	for _, d := range append(append([][]*Tx(nil), duplicates...), timeDuplicates...) {
+		findings = append(findings, finding{rule: "duplicate", title: "Potential duplicates", txs: d})
+	}
+	for _, o := range overlaps {
+		findings = append(findings, finding{rule: "time-overlap", title: "Overlapping time entries", txs: o})
+	}
+	for _, s := range subscriptions {
+		findings = append(findings, finding{rule: "subscription", title: "Several subscription charges in a month", txs: s})
+	}
+	if *checkNotes {
+		for _, n := range findNoteDuplicates(window, *ignoredTag, duplicates, all) {
+			findings = append(findings, finding{rule: "note", title: fmt.Sprintf("Same note %q", memo(n[0].Note)), txs: n})
+		}
+	}
+	findings = append(findings, violations...)
+	findings = append(findings, aliasProblems...)
+	closed := splitList(*closedAccounts)
+	err = readJournals(fileNames, func(fileName string, b []byte) {
+		closed = append(closed, journalClosedAccounts(b)...)
+	})
+	if err != nil {
+		fatal(err.Error())
+	}
+	findings = withoutClosed(findings, closed)
+	findings = withoutIgnored(findings, ignored)
+	if *candidatePath != "" {
+		findings = candidateFindings(*candidatePath, findings)
+	}
+	if newLines != nil {
+		findings = addedFindings(newLines, findings)
+	}
+	// Findings new since the last run, to notify
+	var added, fresh []finding
+	if *baselinePath != "" {
+		baseline, err := loadStates(*baselinePath)
+		if err != nil {
+			fatal(err.Error())
+		}
+		added = notIn(baseline, findings)
+		fresh = added
+	}
+	if *statePath != "" {
+		s, err := loadStates(*statePath)
+		if err != nil {
+			fatal(err.Error())
+		}
+		findings, fresh = s.update(findings, time.Now())
+		if err := s.save(*statePath); err != nil {
+			fatal(err.Error())
+		}
+	}
+	if *withHeader {
+		if runHeader, err = newRunInfo(start, fileNames, flag.CommandLine); err != nil {
+			fatal(err.Error())
+		}
+	}
+	reported, inputFile := findings, fileNames[0]
+	if *anonymize {
+		a, err := newAnonymizer()
+		if err != nil {
+			fatal(err.Error())
+		}
+		reported, inputFile = a.findings(*ignoredTag, findings), a.file(inputFile)
+		if runHeader != nil {
+			runHeader = runHeader.anonymized(a)
+		}
+		if *anonymizeInputs != "" {
+			if err := writeAnonymizedInputs(a, *ignoredTag, fileNames, *ledgerArgs, *anonymizeInputs); err != nil {
+				fatal(err.Error())
+			}
+		}
+	}
+	if err := printReport(*ignoredTag, inputFile, reported); err != nil {
+		fatal(err.Error())
+	}
+	notify(fresh)
+	logAdded(*baselinePath, added)
+
+	if *fix == "merge" {
+		merged, err := fixMerge(*ignoredTag, duplicates, os.Stdin)
+		if err != nil {
+			fatal(err.Error())
+		}
+		slog.Info("merged duplicates", "count", merged)
+	}
+	if *fix == "remove" {
+		removed, err := fixRemove(*ignoredTag, *timeWindow, duplicates, fileNames, *output)
+		if err != nil {
+			fatal(err.Error())
+		}
+		slog.Info("removed duplicates", "count", removed, "output", *output)
+	}
+
+	if err := runHook(*postHook, fmt.Sprintf("LEDGER_LINT_DUPLICATE_FINDINGS=%v", len(findings))); err != nil {
+		fatal(err.Error())
 	}
 
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
 		if err != nil {
-			log.Fatal("could not create memory profile: ", err)
+			fatal("could not create memory profile", "err", err)
 		}
 		defer f.Close() // error handling omitted for example
 		runtime.GC()    // get up-to-date statistics
 		if err := pprof.WriteHeapProfile(f); err != nil {
-			log.Fatal("could not write memory profile: ", err)
+			fatal("could not write memory profile", "err", err)
 		}
 	}
+
+	if undeclared := countRules(findings)["undeclared"]; undeclared > 0 {
+		slog.Error("undeclared accounts or commodities", "count", undeclared)
+		pprof.StopCPUProfile()
+		os.Exit(1)
+	}
+	if len(added) > 0 {
+		slog.Error("findings not in the baseline", "baseline", *baselinePath, "count", len(added))
+		pprof.StopCPUProfile()
+		os.Exit(1)
+	}
+	limit := *maxDuplicates
+	if *ci && limit < 0 {
+		limit = 0
+	}
+	if reportedDuplicates := countRules(findings)["duplicate"]; limit >= 0 && reportedDuplicates > limit {
+		slog.Error("too many duplicates", "count", reportedDuplicates, "max", limit)
+		pprof.StopCPUProfile()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,357 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// TestMain runs the command itself instead of the tests when
+// LEDGER_LINT_DUPLICATE_MAIN is set, for runCommand
+func TestMain(m *testing.M) {
+	if os.Getenv("LEDGER_LINT_DUPLICATE_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand returns the output of the command run with args
+func runCommand(t *testing.T, args ...string) []byte {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "LEDGER_LINT_DUPLICATE_MAIN=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v: %v", err, stderr.String())
+	}
+	return out
+}
+
+func TestGolden(t *testing.T) {
+	for _, c := range []struct {
+		ref  string
+		args []string
+	}{
+		{"ref", []string{"-parser", "native", "test.ledger"}},
+		{"ref-rollover", []string{"-parser", "native", "-file-set", "test-%Y.ledger"}},
+	} {
+		t.Run(c.ref, func(t *testing.T) {
+			want, err := os.ReadFile(c.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := runCommand(t, c.args...); !bytes.Equal(got, want) {
+				t.Errorf("output differs from %v:\n%s", c.ref, got)
+			}
+		})
+	}
+}
+
+// reportGroups returns the groups of a text report, sorted, without the
+// states of their postings
+func reportGroups(report []byte) []string {
+	groups := strings.Split(string(report), "; Potential duplicates:\n")
+	for i := range groups {
+		groups[i] = postingState.ReplaceAllString(groups[i], "$1 ")
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+var postingState = regexp.MustCompile(`(\d{4}-\d\d-\d\d) [*!] `)
+
+// TestGoldenXML checks the output of the first version, ref-xml, from the
+// `ledger xml` export of its test.ledger. Groups were in no particular order
+// then and states were not shown.
+func TestGoldenXML(t *testing.T) {
+	want, err := os.ReadFile("ref-xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := runCommand(t, "test.xml")
+	if !reflect.DeepEqual(reportGroups(got), reportGroups(want)) {
+		t.Errorf("output differs from ref-xml:\n%s", got)
+	}
+}
+
+// describePostings describes the postings of txs, sorted, each like
+// "file:line date state payee account quantity commodity tags"
+func describePostings(txs map[amountKey][]Tx) []string {
+	var described []string
+	for _, bucket := range txs {
+		for _, tx := range bucket {
+			described = append(described, fmt.Sprintf("%v %v %v %v %v %v %v %v", tx.position(), tx.Date.Format("2006-01-02"), tx.State, tx.Payee, tx.Account, tx.quantity(), tx.Commodity, append(append([]string(nil), tx.Tags...), tx.PostingTags...)))
+		}
+	}
+	sort.Strings(described)
+	return described
+}
+
+// naiveDuplicates is bucketDuplicates comparing every pair of postings: the
+// groups are the connected components of the pairs at most window days apart
+// that match
+func naiveDuplicates(match Matcher, window int, ignoredTag string, bucket []Tx) [][]*Tx {
+	var txs []*Tx
+	for i := range bucket {
+		if !find(ignoredTag, bucket[i].PostingTags) {
+			txs = append(txs, &bucket[i])
+		}
+	}
+	component := make([]int, len(txs))
+	for i := range component {
+		component[i] = -1
+	}
+	var groups [][]*Tx
+	for i := range txs {
+		if component[i] >= 0 {
+			continue
+		}
+		component[i] = len(groups)
+		group := []*Tx{txs[i]}
+		for todo := []int{i}; len(todo) > 0; {
+			a := todo[0]
+			todo = todo[1:]
+			for b := range txs {
+				if component[b] < 0 && daysApart(txs[a].Date, txs[b].Date) <= window && match(txs[a], txs[b]) {
+					component[b] = component[i]
+					group = append(group, txs[b])
+					todo = append(todo, b)
+				}
+			}
+		}
+		groups = append(groups, group)
+	}
+	var duplicates [][]*Tx
+	for _, g := range groups {
+		if len(g) > 1 {
+			duplicates = append(duplicates, g)
+		}
+	}
+	return duplicates
+}
+
+// groupSet describes groups by the positions of their postings, whatever
+// their order
+func groupSet(groups [][]*Tx) string {
+	var described []string
+	for _, g := range groups {
+		var positions []int
+		for _, tx := range g {
+			positions = append(positions, tx.Position)
+		}
+		sort.Ints(positions)
+		described = append(described, fmt.Sprint(positions))
+	}
+	sort.Strings(described)
+	return strings.Join(described, " ")
+}
+
+// randomBucket returns up to 40 postings with the same amount over two
+// months, with a few payees and some with the ignore tag
+func randomBucket(r *rand.Rand) []Tx {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bucket := make([]Tx, r.Intn(40))
+	for i := range bucket {
+		bucket[i] = Tx{
+			Tx: dedupe.Tx{
+				Date:   start.AddDate(0, 0, r.Intn(60)),
+				Payee:  []string{"Coffee", "Rent", "Coffee shop", "Bakery"}[r.Intn(4)],
+				Amount: 10,
+			},
+			Position: i,
+		}
+		if r.Intn(10) == 0 {
+			bucket[i].PostingTags = []string{"notDup"}
+		}
+	}
+	return bucket
+}
+
+func TestBucketDuplicatesAreComponents(t *testing.T) {
+	samePayee := func(a, b *Tx) bool { return a.Payee == b.Payee }
+	fuzzy, err := newMatcher("fuzzy-payee", dedupe.MatchOptions{MaxDays: 60, PayeeSimilarity: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matchers := map[string]Matcher{
+		"any":         func(a, b *Tx) bool { return true },
+		"same payee":  samePayee,
+		"fuzzy payee": fuzzy,
+	}
+	for name, match := range matchers {
+		t.Run(name, func(t *testing.T) {
+			property := func(seed int64, window uint8) bool {
+				r := rand.New(rand.NewSource(seed))
+				bucket := randomBucket(r)
+				w := int(window % 20)
+				got := groupSet(bucketDuplicates(match, w, "notDup", append([]Tx(nil), bucket...)))
+				want := groupSet(naiveDuplicates(match, w, "notDup", bucket))
+				if got != want {
+					t.Logf("window %v: got %v, want %v", w, got, want)
+				}
+				return got == want
+			}
+			if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestBucketDuplicates(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	for _, c := range []struct {
+		name   string
+		days   []int
+		window int
+		want   string
+	}{
+		{"empty", nil, 10, ""},
+		{"alone", []int{1}, 10, ""},
+		{"pair", []int{1, 5}, 10, "[0 1]"},
+		{"too far", []int{1, 20}, 10, ""},
+		{"window included", []int{1, 11}, 10, "[0 1]"},
+		// 1 and 21 are only linked through 11
+		{"chain", []int{1, 11, 21}, 10, "[0 1 2]"},
+		{"two groups", []int{1, 2, 25, 26}, 10, "[0 1] [2 3]"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var bucket []Tx
+			for i, d := range c.days {
+				bucket = append(bucket, Tx{Tx: dedupe.Tx{Date: day(d), Amount: 10}, Position: i})
+			}
+			got := groupSet(bucketDuplicates(func(a, b *Tx) bool { return true }, c.window, "notDup", bucket))
+			if got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestToleranceBuckets(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		tolerance string
+		amounts   []string
+		want      string
+	}{
+		{"within", "0.3", []string{"10 EUR", "10.3 EUR"}, "[0 1]"},
+		{"just over", "0.29", []string{"10 EUR", "10.3 EUR"}, ""},
+		// 0.1 + 0.2 is not 0.3 in floating point
+		{"exact", "0.1", []string{"0.2 EUR", "0.3 EUR"}, "[0 1]"},
+		{"other commodity", "0.3", []string{"10 EUR", "10 USD"}, ""},
+		{"relative", "1%", []string{"100 EUR", "101 EUR", "-100 EUR"}, "[0 1]"},
+		{"zeros", "1%", []string{"0 EUR", "0 EUR", "0.01 EUR"}, "[0 1]"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var tol tolerance
+			if err := tol.Set(c.tolerance); err != nil {
+				t.Fatal(err)
+			}
+			txs := make(map[amountKey][]Tx)
+			for i, amount := range c.amounts {
+				q, commodity, err := parseDecimal(amount)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tx := Tx{Tx: dedupe.Tx{Commodity: commodity}, Position: i}
+				tx.setQuantity(q)
+				txs[tx.key()] = append(txs[tx.key()], tx)
+			}
+			var groups [][]*Tx
+			for _, bucket := range toleranceBuckets(txs, tol) {
+				groups = append(groups, bucketDuplicates(allOf(sameCommodity, amountWithin(tol)), 10, "notDup", bucket)...)
+			}
+			if got := groupSet(mergeGroups(groups)); got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLedger(t *testing.T) {
+	const accounts = `<accounts><account id="0x1"><name/><fullname/>
+<account id="0x2"><name>Bank</name><fullname>Assets:Bank</fullname></account>
+</account></accounts>`
+	posting := func(account, quantity, attrs string) string {
+		return fmt.Sprintf(`<posting %v><account ref="0x2"><name>%v</name></account>
+<post-amount><amount><commodity><symbol>EUR</symbol></commodity><quantity>%v</quantity></amount></post-amount></posting>`, attrs, account, quantity)
+	}
+	transaction := func(date, postings string) string {
+		return fmt.Sprintf(`<transaction state="cleared"><date>%v</date><payee>Shop</payee>
+<metadata><tag>trip</tag></metadata><postings>%v</postings></transaction>`, date, postings)
+	}
+	for _, c := range []struct {
+		name         string
+		transactions string
+		lenient      bool
+		want         []string
+		dropped      int
+		skipped      int
+		err          string
+	}{
+		{"account refs", transaction("2024/03/01", posting("Bank", "-10.50", `state="pending"`)), false, []string{
+			"0 2024-03-01 pending Shop Assets:Bank -10.5 EUR [trip]",
+		}, 0, 0, ""},
+		{"generated postings", transaction("2024/03/01", posting("Bank", "1", "")+posting("Bank", "2", `generated="true"`)), false, []string{
+			"0 2024-03-01 cleared Shop Assets:Bank 1 EUR [trip]",
+		}, 0, 0, ""},
+		{"invalid quantity", transaction("2024/03/01", posting("Bank", "NaN", "")), false, nil, 1, 0, ""},
+		{"malformed", transaction("2024/03/01", posting("Bank", "1", "")) + transaction("01/03/2024", ""), false, nil, 0, 0, "transaction at offset"},
+		{"lenient", transaction("2024/03/01", posting("Bank", "1", "")) + transaction("01/03/2024", ""), true, []string{
+			"0 2024-03-01 cleared Shop Assets:Bank 1 EUR [trip]",
+		}, 0, 1, ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := []byte(`<ledger version="196864">` + accounts + "<transactions>" + c.transactions + "</transactions></ledger>")
+			l, skipped, err := decodeLedger(b, c.lenient)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			txs, dropped := l.toTxs(l.accountNames())
+			if got := describePostings(txs); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got postings\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(c.want, "\n"))
+			}
+			if len(dropped) != c.dropped || len(skipped) != c.skipped {
+				t.Errorf("got %v dropped and %v skipped transactions, want %v and %v", len(dropped), len(skipped), c.dropped, c.skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// A Matcher tells whether a and b, two postings with the same amount (or
+// close ones, with -amount-tolerance), may be duplicates. Unlike those of
+// the dedupe package, it sees the whole posting.
+type Matcher func(a, b *Tx) bool
+
+// newMatcher returns a matcher requiring all the comma separated matchers
+// in names, registered in the dedupe package, to match
+func newMatcher(names string, o dedupe.MatchOptions) (Matcher, error) {
+	m, err := dedupe.NewMatcher(names, o)
+	if err != nil {
+		return nil, err
+	}
+	return func(a, b *Tx) bool {
+		return m(&a.Tx, &b.Tx)
+	}, nil
+}
+
+// scanMatcher returns the matcher of postings that may be duplicates, at most
+// maxDays days apart, following -matchers, -payee-threshold, -weights,
+// -time-window, -ignore-metadata and the similar function of s, the -script
+// if not nil. Amounts are left to buckets and -amount-tolerance.
+func scanMatcher(maxDays int, s *script) (Matcher, error) {
+	strategies := *matchers
+	if commandLineFlags(flag.CommandLine)["payee-threshold"] && !find("fuzzy-payee", splitList(strategies)) {
+		strategies += ",fuzzy-payee"
+	}
+	match, err := newMatcher(strategies, dedupe.MatchOptions{
+		MaxDays:         maxDays,
+		PayeeSimilarity: *payeeThreshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if *weightsPath != "" {
+		model, err := loadWeights(*weightsPath)
+		if err != nil {
+			return nil, err
+		}
+		match = model.matcher()
+	}
+	match = allOf(sameCommodity, match)
+	if *timeWindow > 0 {
+		match = allOf(match, timeWithin(*timeWindow))
+	}
+	if *ignoredMetadata != "" {
+		match = allOf(match, notOptedOut(*ignoredMetadata))
+	}
+	if s != nil && s.similar != nil {
+		match = allOf(match, s.matcher(*scriptThreshold))
+	}
+	return match, nil
+}
+
+// amountEpsilon absorbs rounding errors in the width of relative tolerance
+// cells
+const amountEpsilon = 1e-9
+
+// A tolerance is the largest difference between the amounts of duplicates,
+// given as an amount like 0.5 or as a percentage of the largest of them like
+// 1%
+type tolerance struct {
+	// exact is the amount, or the fraction of the largest amount when
+	// relative, nil for none
+	exact    *big.Rat
+	relative bool
+}
+
+func (t *tolerance) String() string {
+	if t.exact == nil {
+		return "0"
+	}
+	if t.relative {
+		return decimalString(new(big.Rat).Mul(t.exact, big.NewRat(100, 1))) + "%"
+	}
+	return decimalString(t.exact)
+}
+
+func (t *tolerance) Set(value string) error {
+	q, err := parseNumber(strings.TrimSuffix(value, "%"))
+	if err != nil {
+		return err
+	}
+	relative := strings.HasSuffix(value, "%")
+	if relative {
+		q.Quo(q, big.NewRat(100, 1))
+	}
+	if q.Sign() < 0 || (relative && q.Cmp(big.NewRat(1, 1)) >= 0) {
+		return fmt.Errorf("tolerance %v not in [0, 100%%)", value)
+	}
+	*t = tolerance{q, relative}
+	return nil
+}
+
+// enabled tells whether amounts may differ at all
+func (t *tolerance) enabled() bool {
+	return t.exact != nil && t.exact.Sign() > 0
+}
+
+// bounds returns the smallest and the largest amounts that may be within t
+// of q, some of those with a relative tolerance not being
+func (t *tolerance) bounds(q *big.Rat) (low, high *big.Rat) {
+	if !t.enabled() {
+		return q, q
+	}
+	allowed := t.exact
+	if t.relative {
+		// b is within t of q only if |q - b| <= t(|q| + |q - b|)
+		allowed = new(big.Rat).Abs(q)
+		allowed.Mul(allowed, t.exact)
+		allowed.Quo(allowed, new(big.Rat).Sub(big.NewRat(1, 1), t.exact))
+	}
+	return new(big.Rat).Sub(q, allowed), new(big.Rat).Add(q, allowed)
+}
+
+// amountWithin matches postings with amounts differing by at most t, the
+// difference being computed exactly
+func amountWithin(t tolerance) Matcher {
+	return func(a, b *Tx) bool {
+		if a.quantity() == b.quantity() {
+			return true
+		}
+		qa, qb := a.exact(), b.exact()
+		allowed := t.exact
+		if t.relative {
+			largest := new(big.Rat).Abs(qa)
+			if abs := new(big.Rat).Abs(qb); abs.Cmp(largest) > 0 {
+				largest = abs
+			}
+			allowed = new(big.Rat).Mul(t.exact, largest)
+		}
+		delta := new(big.Rat).Sub(qa, qb)
+		return delta.Abs(delta).Cmp(allowed) <= 0
+	}
+}
+
+// timeApart returns the time between a and b, if both have their time of
+// day in time: metadata, like 14:05 or 14:05:30
+func timeApart(a, b *Tx) (time.Duration, bool) {
+	at := func(tx *Tx) (time.Time, bool) {
+		for _, layout := range []string{"15:04:05", "15:04"} {
+			if t, err := time.Parse(layout, strings.TrimSpace(tx.Meta("time"))); err == nil {
+				return tx.Date.Add(t.Sub(t.Truncate(24 * time.Hour))), true
+			}
+		}
+		return time.Time{}, false
+	}
+	ta, okA := at(a)
+	tb, okB := at(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	d := tb.Sub(ta)
+	if d < 0 {
+		d = -d
+	}
+	return d, true
+}
+
+// timeWithin matches postings at most window apart, when both have their
+// time of day, and other postings unconditionally
+func timeWithin(window time.Duration) Matcher {
+	return func(a, b *Tx) bool {
+		d, timed := timeApart(a, b)
+		return !timed || d <= window
+	}
+}
+
+// sameCommodity matches postings in the same commodity, for 50 EUR and 50 USD
+// not to be duplicates
+func sameCommodity(a, b *Tx) bool {
+	return a.Commodity == b.Commodity
+}
+
+// notOptedOut matches postings unless one of them has metadata key, like
+// "; not-duplicate: true", with a value other than false, no or 0
+func notOptedOut(key string) Matcher {
+	return func(a, b *Tx) bool {
+		return !optedOut(a, key) && !optedOut(b, key)
+	}
+}
+
+// optedOut tells whether tx has the metadata key, with a value other than
+// false, no or 0
+func optedOut(tx *Tx, key string) bool {
+	switch strings.ToLower(strings.TrimSpace(tx.Meta(key))) {
+	case "", "false", "no", "0":
+		return false
+	}
+	return true
+}
+
+// allOf returns a matcher requiring all of matchers to match
+func allOf(matchers ...Matcher) Matcher {
+	return func(a, b *Tx) bool {
+		for _, m := range matchers {
+			if !m(a, b) {
+				return false
+			}
+		}
+		return true
+	}
+}
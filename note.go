@@ -0,0 +1,130 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var checkNotes = flag.Bool("check-notes", false, "report distinct transactions with the same note within -days of each other, even with different amounts")
+
+// minMemoLength is the length below which memos, like "ok" or "cash", are too
+// common to tell anything
+const minMemoLength = 8
+
+// memo returns the text of note without its tags and metadata, spaces
+// collapsed
+func memo(note string) string {
+	var words []string
+	for _, line := range strings.Split(note, "\n") {
+		if commentMetadata.MatchString(line) {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if len(field) >= 3 && field[0] == ':' && field[len(field)-1] == ':' {
+				continue
+			}
+			words = append(words, field)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// findNoteDuplicates returns the groups of distinct transactions with the same
+// memo, compared case-insensitively, each at most window apart from the
+// previous one. The largest posting stands for each transaction. Groups whose
+// transactions are all in one of duplicates already, or all have ignoredTag,
+// are left out.
+func findNoteDuplicates(window int, ignoredTag string, duplicates [][]*Tx, txs []*Tx) (groups [][]*Tx) {
+	type transaction struct {
+		input    string
+		position int
+	}
+	group := make(map[transaction]int)
+	for i, g := range duplicates {
+		for _, tx := range g {
+			group[transaction{tx.Input, tx.Position}] = i + 1
+		}
+	}
+
+	// The largest posting is usually the charge
+	chosen := make(map[transaction]*Tx)
+	for _, tx := range txs {
+		t := transaction{tx.Input, tx.Position}
+		if c, exists := chosen[t]; !exists || chosenOver(tx, c) {
+			chosen[t] = tx
+		}
+	}
+	sorted := make([]*Tx, 0, len(chosen))
+	for _, tx := range chosen {
+		sorted = append(sorted, tx)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.Before(sorted[j].Date)
+		}
+		if sorted[i].Input != sorted[j].Input {
+			return sorted[i].Input < sorted[j].Input
+		}
+		return sorted[i].Position < sorted[j].Position
+	})
+
+	var memos []string
+	byMemo := make(map[string][]*Tx)
+	for _, tx := range sorted {
+		m := strings.ToLower(memo(tx.Note))
+		if utf8.RuneCountInString(m) < minMemoLength {
+			continue
+		}
+		if _, exists := byMemo[m]; !exists {
+			memos = append(memos, m)
+		}
+		byMemo[m] = append(byMemo[m], tx)
+	}
+
+	keep := func(g []*Tx) {
+		if len(g) < 2 {
+			return
+		}
+		first, ignored := group[transaction{g[0].Input, g[0].Position}], true
+		known := first != 0
+		for _, tx := range g {
+			known = known && group[transaction{tx.Input, tx.Position}] == first
+			ignored = ignored && find(ignoredTag, tx.Tags)
+		}
+		if !known && !ignored {
+			groups = append(groups, g)
+		}
+	}
+	for _, m := range memos {
+		sameMemo := byMemo[m]
+		start := 0
+		for i := 1; i < len(sameMemo); i++ {
+			if daysApart(sameMemo[i-1].Date, sameMemo[i].Date) > window {
+				keep(sameMemo[start:i])
+				start = i
+			}
+		}
+		keep(sameMemo[start:])
+	}
+	return groups
+}
@@ -0,0 +1,208 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var matrixHomeserver = flag.String("matrix-homeserver", "", "`URL` of the Matrix homeserver to send a summary of findings to")
+var matrixToken = flag.String("matrix-token", "", "access token of the Matrix account sending the summary")
+var matrixRoom = flag.String("matrix-room", "", "`id` of the Matrix room to send the summary to, like !abc:example.org")
+var telegramToken = flag.String("telegram-token", "", "token of the Telegram bot sending a summary of findings")
+var telegramChat = flag.String("telegram-chat", "", "`id` of the Telegram chat to send the summary to")
+var ntfyTopic = flag.String("ntfy", "", "ntfy topic `URL` to push a summary of findings to, like https://ntfy.sh/mytopic")
+var ntfyClick = flag.String("ntfy-click", "", "`URL` to open when tapping the ntfy notification, like that of a published report")
+
+var webhookURL = flag.String("webhook", "", "`URL` to post a JSON summary of findings to")
+var webhookSecret = flag.String("webhook-secret", "", "secret to sign webhook payloads with, as HMAC-SHA256 in the X-Ledger-Lint-Signature header")
+
+// A notifier sends a summary of the findings somewhere
+type notifier func(summary string, findings []finding) error
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// notifiers returns the notifiers configured with flags
+func notifiers() (n []notifier) {
+	if *matrixHomeserver != "" && *matrixRoom != "" {
+		n = append(n, notifyMatrix)
+	}
+	if *telegramToken != "" && *telegramChat != "" {
+		n = append(n, notifyTelegram)
+	}
+	if *ntfyTopic != "" {
+		n = append(n, notifyNtfy)
+	}
+	if *webhookURL != "" {
+		n = append(n, notifyWebhook)
+	}
+	return n
+}
+
+// notify sends a summary of findings, those new since the last run, with
+// each notifier, if there are any. Failures are only logged, the report being
+// out already.
+func notify(findings []finding) {
+	if len(findings) == 0 {
+		return
+	}
+	summary := summarize(findings)
+	for _, n := range notifiers() {
+		if err := n(summary, findings); err != nil {
+			slog.Warn("could not send notification", "err", err)
+		}
+	}
+}
+
+// countRules returns the number of findings of each rule
+func countRules(findings []finding) map[string]int {
+	byRule := make(map[string]int)
+	for _, f := range findings {
+		byRule[f.rule]++
+	}
+	return byRule
+}
+
+// summarize returns a line about new findings like "2 new potential
+// duplicates, 1 other new finding (alias: 1)"
+func summarize(findings []finding) string {
+	byRule := countRules(findings)
+	var parts, others []string
+	if n := byRule["duplicate"]; n > 0 {
+		parts = append(parts, plural(n, "new potential duplicate", "new potential duplicates"))
+	}
+	for rule, n := range byRule {
+		if rule != "duplicate" {
+			others = append(others, fmt.Sprintf("%v: %v", rule, n))
+		}
+	}
+	if n := len(findings) - byRule["duplicate"]; n > 0 {
+		sort.Strings(others)
+		what := "new finding"
+		if len(parts) > 0 {
+			what = "other new finding"
+		}
+		parts = append(parts, fmt.Sprintf("%v (%v)", plural(n, what, what+"s"), strings.Join(others, ", ")))
+	}
+	return "ledger-lint-duplicate: " + strings.Join(parts, ", ")
+}
+
+// plural returns n followed by one or many, depending on n
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return fmt.Sprintf("%v %v", n, one)
+	}
+	return fmt.Sprintf("%v %v", n, many)
+}
+
+// send makes a request with body encoded as JSON, failing on an error status
+func send(method, url string, body interface{}, header http.Header) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(req)
+}
+
+// do sends req, failing on an error status
+func do(req *http.Request) error {
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%v %v: %v", req.Method, req.URL.Redacted(), resp.Status)
+	}
+	return nil
+}
+
+func notifyMatrix(summary string, findings []finding) error {
+	u := fmt.Sprintf("%v/_matrix/client/v3/rooms/%v/send/m.room.message/%v",
+		strings.TrimSuffix(*matrixHomeserver, "/"), url.PathEscape(*matrixRoom), time.Now().UnixNano())
+	return send(http.MethodPut, u, map[string]string{"msgtype": "m.notice", "body": summary},
+		http.Header{"Authorization": {"Bearer " + *matrixToken}})
+}
+
+func notifyTelegram(summary string, findings []finding) error {
+	// The token is in the path, keep it out of errors
+	u := fmt.Sprintf("https://api.telegram.org/bot%v/sendMessage", *telegramToken)
+	err := send(http.MethodPost, u, map[string]string{"chat_id": *telegramChat, "text": summary}, nil)
+	if err != nil {
+		return fmt.Errorf("telegram: %v", strings.ReplaceAll(err.Error(), *telegramToken, "<token>"))
+	}
+	return nil
+}
+
+// notifyNtfy publishes the summary on the ntfy topic, as plain text
+func notifyNtfy(summary string, findings []finding) error {
+	req, err := http.NewRequest(http.MethodPost, *ntfyTopic, strings.NewReader(summary))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", "ledger-lint-duplicate")
+	if *ntfyClick != "" {
+		req.Header.Set("Click", *ntfyClick)
+	}
+	return do(req)
+}
+
+// notifyWebhook posts the summary and the number of findings by rule as JSON,
+// signed with the webhook secret if any
+func notifyWebhook(summary string, findings []finding) error {
+	b, err := json.Marshal(map[string]interface{}{
+		"summary":  summary,
+		"findings": len(findings),
+		"rules":    countRules(findings),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, *webhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if *webhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(*webhookSecret))
+		mac.Write(b)
+		req.Header.Set("X-Ledger-Lint-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return do(req)
+}
@@ -0,0 +1,44 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import "testing"
+
+func TestSummarize(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		rules []string
+		want  string
+	}{
+		{"one duplicate", []string{"duplicate"}, "ledger-lint-duplicate: 1 new potential duplicate"},
+		{"duplicates", []string{"duplicate", "duplicate"}, "ledger-lint-duplicate: 2 new potential duplicates"},
+		{"others", []string{"alias", "commodity", "alias"}, "ledger-lint-duplicate: 3 new findings (alias: 2, commodity: 1)"},
+		{"both", []string{"duplicate", "duplicate", "alias"}, "ledger-lint-duplicate: 2 new potential duplicates, 1 other new finding (alias: 1)"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var findings []finding
+			for _, rule := range c.rules {
+				findings = append(findings, finding{rule: rule})
+			}
+			if got := summarize(findings); got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+var exportPairs = flag.String("export-pairs", "", "write all candidate pairs of postings to this CSV `file`, with their features and an empty label column, to label them by hand")
+
+// pairsHeader is the header of -export-pairs. matched tells whether the
+// matchers found the pair to be duplicates.
+var pairsHeader = append(append([]string{
+	"a_position", "a_date", "a_payee", "a_account", "a_amount",
+	"b_position", "b_date", "b_payee", "b_account", "b_amount",
+}, pairFeatureNames[:]...), "matched", "label")
+
+// writePairs writes to fileName, as CSV, the pairs of postings sharing a bucket
+// of txs and at most window apart, the candidates compared by match. Postings
+// with the ignore tag are left out, like in bucketDuplicates.
+func writePairs(fileName string, match Matcher, window int, ignoredTag string, txs map[amountKey][]Tx) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write(pairsHeader); err != nil {
+		return err
+	}
+
+	// Tolerance buckets overlap, pairs are only written once
+	type key struct {
+		input, account string
+		position       int
+		amount         amountKey
+	}
+	written := make(map[[2]key]bool)
+	for _, amount := range sortedKeys(txs) {
+		var bucket []*Tx
+		for i := range txs[amount] {
+			if !find(ignoredTag, txs[amount][i].PostingTags) {
+				bucket = append(bucket, &txs[amount][i])
+			}
+		}
+		sort.SliceStable(bucket, func(i, j int) bool {
+			if !bucket[i].Date.Equal(bucket[j].Date) {
+				return bucket[i].Date.Before(bucket[j].Date)
+			}
+			if bucket[i].Input != bucket[j].Input {
+				return bucket[i].Input < bucket[j].Input
+			}
+			return bucket[i].Position < bucket[j].Position
+		})
+		start := 0
+		for i, b := range bucket {
+			for daysApart(bucket[start].Date, b.Date) > window {
+				start++
+			}
+			for _, a := range bucket[start:i] {
+				k := [2]key{{a.Input, a.Account, a.Position, a.key()}, {b.Input, b.Account, b.Position, b.key()}}
+				if written[k] {
+					continue
+				}
+				written[k] = true
+				if err := w.Write(pairRecord(a, b, match(a, b))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// pairRecord returns the line of -export-pairs for a and b
+func pairRecord(a, b *Tx, matched bool) []string {
+	amount := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	features := pairFeatures(a, b)
+	return []string{
+		a.position(), a.Date.Format("2006-01-02"), a.Payee, a.Account, amount(a.Amount),
+		b.position(), b.Date.Format("2006-01-02"), b.Payee, b.Account, amount(b.Amount),
+		amount(features[0]),
+		fmt.Sprintf("%.3f", features[1]),
+		amount(features[2]),
+		strconv.FormatBool(matched),
+		"",
+	}
+}
@@ -0,0 +1,255 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var requiredTagFlags stringsFlag
+var checkCommodities = flag.Bool("check-commodities", false, "report postings in a commodity new to their account")
+var checkAssertions = flag.Bool("check-assertions", false, "report balance assertions of an account with different values on the same day")
+var maxAccountDepth = flag.Int("max-account-depth", 0, "report postings to accounts with more than this number of levels, 0 for no limit")
+var accountPattern = flag.String("account-pattern", "", "report postings to accounts with a level not matching this `regexp`, like [A-Z][A-Za-z0-9]*")
+
+func init() {
+	flag.Var(&requiredTagFlags, "require-tag", "report postings to accounts starting with `account` without tag, given as account=tag, like Expenses:Business:=receipt; repeatable")
+}
+
+// stringsFlag is a flag that can be repeated, keeping all values
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func (s *stringsFlag) reset() {
+	*s = nil
+}
+
+// hasTag returns true if tx, or its posting, has tag as a tag or as a
+// metadata key
+func (tx *Tx) hasTag(tag string) bool {
+	if find(tag, tx.Tags) || find(tag, tx.PostingTags) {
+		return true
+	}
+	_, exists := tx.Metadata[tag]
+	return exists
+}
+
+// requiredTag is a rule requiring every posting to an account starting with
+// prefix to have tag
+type requiredTag struct {
+	prefix, tag string
+}
+
+// parseRequiredTag parses "Expenses:Business:=receipt"
+func parseRequiredTag(s string) (requiredTag, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return requiredTag{}, fmt.Errorf("expected account=tag, got %q", s)
+	}
+	return requiredTag{prefix: s[:i], tag: s[i+1:]}, nil
+}
+
+// allTxs returns copies of all postings of txs, in input order
+func allTxs(txs map[amountKey][]Tx) []*Tx {
+	var all []*Tx
+	for _, bucket := range txs {
+		for i := range bucket {
+			tx := bucket[i]
+			all = append(all, &tx)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Input != all[j].Input {
+			return all[i].Input < all[j].Input
+		}
+		return all[i].Position < all[j].Position
+	})
+	return all
+}
+
+// checkRequiredTags returns, for each rule, the postings missing its tag.
+// Postings with ignoredTag are exempt.
+func checkRequiredTags(rules []requiredTag, ignoredTag string, txs []*Tx) (violations []finding) {
+	for _, rule := range rules {
+		v := finding{rule: "required-tag", title: fmt.Sprintf("Missing tag %v on %v postings", rule.tag, rule.prefix)}
+		for _, tx := range txs {
+			if strings.HasPrefix(tx.Account, rule.prefix) && !tx.hasTag(rule.tag) && !tx.hasTag(ignoredTag) {
+				v.txs = append(v.txs, tx)
+			}
+		}
+		if len(v.txs) > 0 {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// checkAccounts returns the postings to accounts with more than maxDepth
+// levels, and those to accounts with a level not matching segment. A zero
+// maxDepth or a nil segment disables the corresponding check.
+func checkAccounts(maxDepth int, segment *regexp.Regexp, ignoredTag string, txs []*Tx) (violations []finding) {
+	deep := finding{rule: "account-depth", title: fmt.Sprintf("Accounts deeper than %v levels", maxDepth)}
+	named := finding{rule: "account-name"}
+	if segment != nil {
+		named.title = fmt.Sprintf("Account levels not matching %v", segment)
+	}
+	for _, tx := range txs {
+		if tx.hasTag(ignoredTag) {
+			continue
+		}
+		levels := strings.Split(tx.Account, ":")
+		if maxDepth > 0 && len(levels) > maxDepth {
+			deep.txs = append(deep.txs, tx)
+		}
+		if segment == nil {
+			continue
+		}
+		for _, level := range levels {
+			if !segment.MatchString(level) {
+				named.txs = append(named.txs, tx)
+				break
+			}
+		}
+	}
+	for _, v := range []finding{deep, named} {
+		if len(v.txs) > 0 {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// checkPolicies applies the hygiene rules given as flags to txs
+func checkPolicies(ignoredTag string, txs []*Tx) (violations []finding) {
+	if len(requiredTagFlags) > 0 {
+		var rules []requiredTag
+		for _, f := range requiredTagFlags {
+			rule, err := parseRequiredTag(f)
+			if err != nil {
+				fatal(err.Error())
+			}
+			rules = append(rules, rule)
+		}
+		violations = append(violations, checkRequiredTags(rules, ignoredTag, txs)...)
+	}
+	if *maxAccountDepth > 0 || *accountPattern != "" {
+		var segment *regexp.Regexp
+		if *accountPattern != "" {
+			var err error
+			// Anchored, for the whole level to match
+			segment, err = regexp.Compile("^(?:" + *accountPattern + ")$")
+			if err != nil {
+				fatal("invalid account pattern", "err", err)
+			}
+		}
+		violations = append(violations, checkAccounts(*maxAccountDepth, segment, ignoredTag, txs)...)
+	}
+	if *checkCommodities {
+		violations = append(violations, checkAccountCommodities(ignoredTag, txs)...)
+	}
+	if *checkAssertions {
+		violations = append(violations, checkBalanceAssertions(txs)...)
+	}
+	return violations
+}
+
+// checkAccountCommodities returns the postings to an account in a commodity
+// other than that of its first posting, grouped by account and commodity
+func checkAccountCommodities(ignoredTag string, txs []*Tx) (violations []finding) {
+	txs = append([]*Tx(nil), txs...)
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].Date.Before(txs[j].Date)
+	})
+	first := make(map[string]string)
+	index := make(map[[2]string]int)
+	for _, tx := range txs {
+		if tx.hasTag(ignoredTag) {
+			continue
+		}
+		commodity, exists := first[tx.Account]
+		if !exists {
+			first[tx.Account] = tx.Commodity
+			continue
+		}
+		if tx.Commodity == commodity {
+			continue
+		}
+		k := [2]string{tx.Account, tx.Commodity}
+		i, exists := index[k]
+		if !exists {
+			i = len(violations)
+			index[k] = i
+			violations = append(violations, finding{
+				rule:  "commodity",
+				title: fmt.Sprintf("Commodity %q new to %v, first used with %q", tx.Commodity, tx.Account, commodity),
+			})
+		}
+		violations[i].txs = append(violations[i].txs, tx)
+	}
+	return violations
+}
+
+// checkBalanceAssertions returns the balance assertions of an account in a
+// commodity on the same day, when they assert different values
+func checkBalanceAssertions(txs []*Tx) (violations []finding) {
+	type key struct {
+		account, commodity string
+		date               time.Time
+	}
+	var keys []key
+	assertions := make(map[key][]*Tx)
+	for _, tx := range txs {
+		if tx.Assertion == nil {
+			continue
+		}
+		k := key{tx.Account, tx.Commodity, tx.Date}
+		if _, exists := assertions[k]; !exists {
+			keys = append(keys, k)
+		}
+		assertions[k] = append(assertions[k], tx)
+	}
+
+	for _, k := range keys {
+		group := assertions[k]
+		for _, tx := range group[1:] {
+			if *tx.Assertion != *group[0].Assertion {
+				violations = append(violations, finding{
+					rule:  "balance-assertion",
+					title: fmt.Sprintf("Balance assertions of %v differ on %v", k.account, k.date.Format("2006-01-02")),
+					txs:   group,
+				})
+				break
+			}
+		}
+	}
+	return violations
+}
@@ -0,0 +1,119 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// queryCommand prints whether the postings of a transaction would be
+// duplicates of those of the ledger, and why. args are either a date, a
+// payee and an amount, like 2024-03-01 Shop "12.50 EUR", followed by the files
+// of the ledger, or only the files, the transaction being then read as a
+// journal from stdin. It returns whether there are duplicates.
+func queryCommand(match Matcher, args []string) (bool, error) {
+	var candidates []Tx
+	if len(args) >= 3 {
+		if date, err := time.Parse("2006-01-02", strings.ReplaceAll(args[0], "/", "-")); err == nil {
+			amount, commodity, err := parseDecimal(args[2])
+			if err != nil {
+				return false, fmt.Errorf("invalid amount %q: %w", args[2], err)
+			}
+			candidates = []Tx{{Tx: dedupe.Tx{Date: date, Payee: args[1], Commodity: commodity}, Position: -1, Input: "query"}}
+			candidates[0].setQuantity(amount)
+			args = args[3:]
+		}
+	}
+	if candidates == nil {
+		b, err := readInput(stdinFile)
+		if err != nil {
+			return false, err
+		}
+		read, err := parseJournal(stdinFile, b)
+		if err != nil {
+			return false, err
+		}
+		for _, tx := range allTxs(read) {
+			candidates = append(candidates, *tx)
+		}
+		if len(candidates) == 0 {
+			return false, fmt.Errorf("no transaction on stdin")
+		}
+	}
+	fileNames := args
+	if *fileSet != "" {
+		set, err := expandFileSet(*fileSet)
+		if err != nil {
+			return false, err
+		}
+		fileNames = append(fileNames, set...)
+	}
+	if len(fileNames) == 0 {
+		return false, fmt.Errorf("query needs the files of the ledger")
+	}
+	txs, _, err := mergeInputs(loadFiles(*jobs, *ledgerArgs, *lenient, uniqueFiles(fileNames)))
+	if err != nil {
+		return false, err
+	}
+
+	// Like the scan, whatever the matchers
+	window := windowDays(*days)
+	duplicate := false
+	for i := range candidates {
+		c := &candidates[i]
+		var matches []*Tx
+		sameAmount := 0
+		for _, tx := range allTxs(txs) {
+			// The commodities are compared below, that of c being optional
+			if tx.quantity() != c.quantity() && !(amountTolerance.enabled() && amountWithin(amountTolerance)(tx, c)) {
+				continue
+			}
+			sameAmount++
+			// Without a commodity, the amount is in any
+			candidate := *c
+			if candidate.Commodity == "" {
+				candidate.Commodity = tx.Commodity
+			}
+			if daysApart(tx.Date, c.Date) <= window && match(tx, &candidate) {
+				matches = append(matches, tx)
+			}
+		}
+		fmt.Println(strings.TrimSpace(fmt.Sprintf("%v %v\t%v %v", c.Date.Format("2006-01-02"), c.Payee, c.Amount, c.Commodity)))
+		if len(matches) == 0 {
+			fmt.Printf("\tnot a duplicate: %v postings with this amount, none matching within %v days\n", sameAmount, window)
+			continue
+		}
+		duplicate = true
+		for _, tx := range matches {
+			days := daysApart(c.Date, tx.Date)
+			fmt.Printf("\tduplicate of (%v) %v %v%v, %v %v %v: %v days apart, payees %.0f%% similar",
+				tx.position(), tx.Date.Format("2006-01-02"), tx.mark(), tx.Payee, tx.Account, tx.Amount, tx.Commodity,
+				days, 100*dedupe.PayeeSimilarity(c.Payee, tx.Payee))
+			if tx.quantity() != c.quantity() {
+				fmt.Printf(", amounts %v apart", amountDelta(tx, c))
+			}
+			fmt.Println()
+		}
+	}
+	return duplicate, nil
+}
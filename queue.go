@@ -0,0 +1,150 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// verdictSuffix is appended to the name of a queued candidate file for that
+// of its verdicts
+const verdictSuffix = ".verdict.json"
+
+// readCandidates returns the candidates of a queued file: a JSON object, or a
+// CSV file with a header naming its date, payee, account, amount and
+// optionally workspace columns
+func readCandidates(fileName string) ([]Candidate, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(fileName) == ".json" {
+		var c Candidate
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("%v: %w", fileName, err)
+		}
+		return []Candidate{c}, nil
+	}
+
+	candidates, err := csvCandidates(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", fileName, err)
+	}
+	return candidates, nil
+}
+
+// csvCandidates returns the candidates of r, CSV with a header naming its
+// date, payee, account, amount and optionally workspace columns
+func csvCandidates(r io.Reader) ([]Candidate, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	field := func(record []string, name string) string {
+		if i, exists := columns[name]; exists && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	var candidates []Candidate
+	for i, record := range records[1:] {
+		amount, commodity, err := parseDecimal(field(record, "amount"))
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", i+2, err)
+		}
+		candidates = append(candidates, Candidate{
+			Workspace: field(record, "workspace"),
+			Date:      field(record, "date"),
+			Payee:     field(record, "payee"),
+			Account:   field(record, "account"),
+			Amount:    json.Number(decimalString(amount)),
+			Commodity: commodity,
+		})
+	}
+	return candidates, nil
+}
+
+// queue checks the candidates of each .json and .csv file of dir, the
+// pending transactions of an importer, writing their verdicts, one per line,
+// next to it. Files with verdicts newer than themselves are skipped.
+func (ws Workspaces) queue(dir string) error {
+	var fileNames []string
+	for _, pattern := range []string{"*.json", "*.csv"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			if !strings.HasSuffix(m, verdictSuffix) {
+				fileNames = append(fileNames, m)
+			}
+		}
+	}
+	sort.Strings(fileNames)
+
+	checked, duplicates := 0, 0
+	for _, fileName := range fileNames {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return err
+		}
+		if v, err := os.Stat(fileName + verdictSuffix); err == nil && !v.ModTime().Before(info.ModTime()) {
+			continue
+		}
+		candidates, err := readCandidates(fileName)
+		if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		enc := json.NewEncoder(&out)
+		for _, c := range candidates {
+			v := ws.check(c)
+			v.Version = schemaVersion
+			if v.Duplicate {
+				duplicates++
+			}
+			if err := enc.Encode(v); err != nil {
+				return err
+			}
+		}
+		if err := writeFile(fileName+verdictSuffix, out.Bytes()); err != nil {
+			return err
+		}
+		checked++
+	}
+	slog.Info("checked queued candidates", "dir", dir, "files", checked, "duplicates", duplicates)
+	return nil
+}
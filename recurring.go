@@ -0,0 +1,99 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"sort"
+	"strings"
+)
+
+var noRecurringFilter = flag.Bool("no-recurring-filter", false, "also report duplicates that are occurrences of recurring postings in consecutive periods, like rent paid early")
+
+// minRecurrences is the number of postings with the same payee, account and
+// amount to be recurring
+const minRecurrences = 3
+
+// dropRecurring returns groups without those whose postings are occurrences
+// of a series of all, postings with the same payee, account and amount
+// spaced by one of periods, each in a different period. Rent paid early one
+// month may be within -days of the previous one, while rent paid twice is
+// still reported.
+func dropRecurring(all []*Tx, groups [][]*Tx) (kept [][]*Tx) {
+	type key struct {
+		payee, account string
+		amount         amountKey
+	}
+	series := make(map[key][]*Tx)
+	for _, tx := range all {
+		k := key{strings.ToLower(tx.Payee), tx.Account, tx.key()}
+		series[k] = append(series[k], tx)
+	}
+	for _, g := range groups {
+		k := key{strings.ToLower(g[0].Payee), g[0].Account, g[0].key()}
+		same := true
+		for _, tx := range g[1:] {
+			same = same && (key{strings.ToLower(tx.Payee), tx.Account, tx.key()}) == k
+		}
+		if p, ok := seriesPeriod(series[k]); same && ok && inDistinctSlots(p, g) {
+			auditGroup("occurrences of "+p.name+" postings, with -no-recurring-filter to report them", "duplicate", g)
+			continue
+		}
+		kept = append(kept, g)
+	}
+	return kept
+}
+
+// seriesPeriod returns the period of txs, when there are at least
+// minRecurrences of them and the days between most of them are those of the
+// period
+func seriesPeriod(txs []*Tx) (period, bool) {
+	if len(txs) < minRecurrences {
+		return period{}, false
+	}
+	sorted := append([]*Tx(nil), txs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+	gaps := make([]int, 0, len(sorted)-1)
+	for i, tx := range sorted[1:] {
+		gaps = append(gaps, daysApart(sorted[i].Date, tx.Date))
+	}
+	sort.Ints(gaps)
+	median := gaps[len(gaps)/2]
+	for _, p := range periods {
+		if median >= p.shortest && median <= p.longest {
+			return p, true
+		}
+	}
+	return period{}, false
+}
+
+// inDistinctSlots tells whether each posting of txs is in a different p
+func inDistinctSlots(p period, txs []*Tx) bool {
+	slots := make(map[int]bool)
+	for _, tx := range txs {
+		s := p.slot(tx.Date)
+		if slots[s] {
+			return false
+		}
+		slots[s] = true
+	}
+	return true
+}
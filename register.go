@@ -0,0 +1,121 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// registerFormat is the format of `ledger register --format` read as input,
+// for ledger builds without xml: a line for each posting, with its file, the
+// line of its transaction and its own, its date, state, payee, account,
+// quantity and commodity, separated by tabs
+const registerFormat = `%(filename)\t%(xact.beg_line)\t%(beg_line)\t%(format_date(date, "%Y/%m/%d"))\t%(cleared ? "*" : (pending ? "!" : ""))\t%(payee)\t%(account)\t%(quantity(scrub(amount)))\t%(commodity(scrub(amount)))\n`
+
+// registerFields is the number of fields of lines in registerFormat
+const registerFields = 9
+
+// exportRegister runs `ledger register` on the journal fileName, with
+// registerFormat
+func exportRegister(fileName string, ledgerArgs string) ([]byte, error) {
+	return export(fileName, ledgerArgs, "register", "--format", registerFormat)
+}
+
+// isRegister tells whether b, an input, is the output of `ledger register`
+// with registerFormat
+func isRegister(b []byte) bool {
+	line, _, _ := bytes.Cut(bytes.TrimSpace(b), []byte("\n"))
+	fields := strings.Split(string(line), "\t")
+	if len(fields) != registerFields {
+		return false
+	}
+	_, lineErr := strconv.Atoi(fields[1])
+	_, dateErr := time.Parse("2006/01/02", fields[3])
+	return lineErr == nil && dateErr == nil
+}
+
+// parseRegister reads the postings of b, the output of `ledger register`
+// with registerFormat. It has neither tags, metadata nor notes.
+func parseRegister(fileName string, b []byte) (map[amountKey][]Tx, error) {
+	txs := make(map[amountKey][]Tx)
+	strs := make(interner)
+	type transaction struct {
+		file string
+		line string
+	}
+	positions := make(map[transaction]int)
+	for i, line := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != registerFields {
+			return nil, fmt.Errorf("%v:%v: %v fields instead of %v, not in the register format", fileName, i+1, len(fields), registerFields)
+		}
+		date, err := time.Parse("2006/01/02", fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", fileName, i+1, err)
+		}
+		postLine, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: invalid line: %w", fileName, i+1, err)
+		}
+		// The line of the transaction, checked by isRegister for the
+		// first posting only
+		headerLine, _ := strconv.Atoi(fields[1])
+		amount, _, err := parseDecimal(fields[7])
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", fileName, i+1, err)
+		}
+		t := transaction{fields[0], fields[1]}
+		position, exists := positions[t]
+		if !exists {
+			position = len(positions)
+			positions[t] = position
+		}
+		tx := Tx{
+			Tx: dedupe.Tx{
+				Date:      date,
+				File:      strs.intern(fields[0]),
+				Line:      postLine,
+				Payee:     strs.intern(fields[5]),
+				Account:   strs.intern(fields[6]),
+				Commodity: strs.intern(fields[8]),
+			},
+			Position:   position,
+			HeaderLine: headerLine,
+		}
+		tx.setQuantity(amount)
+		if fields[4] != "" {
+			tx.State = journalStates[fields[4][0]]
+		}
+		if reason := skipped(&tx); reason != "" {
+			audit(reason, &tx)
+			continue
+		}
+		txs[tx.key()] = append(txs[tx.key()], tx)
+	}
+	return txs, nil
+}
@@ -0,0 +1,64 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRegister(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		register string
+		want     []string
+		err      string
+	}{
+		{"postings", "main.ledger\t3\t4\t2024/03/01\t*\tShop\tExpenses:Food\t10.50\tEUR\n" +
+			"main.ledger\t3\t5\t2024/03/01\t*\tShop\tAssets:Bank\t-10.50\tEUR\n" +
+			"main.ledger\t7\t8\t2024/03/02\t!\tBakery\tExpenses:Food\t3\t$\n", []string{
+			"main.ledger:4 2024-03-01 cleared Shop Expenses:Food 10.5 EUR []",
+			"main.ledger:5 2024-03-01 cleared Shop Assets:Bank -10.5 EUR []",
+			"main.ledger:8 2024-03-02 pending Bakery Expenses:Food 3 $ []",
+		}, ""},
+		{"missing fields", "main.ledger\t3\t4\t2024/03/01\t*\tShop\n", nil, "register.txt:1: 6 fields instead of 9"},
+		{"invalid date", "main.ledger\t3\t4\t01/03/2024\t\tShop\tExpenses:Food\t10\tEUR\n", nil, "register.txt:1"},
+		{"invalid amount", "main.ledger\t3\t4\t2024/03/01\t\tShop\tExpenses:Food\tten\tEUR\n", nil, "register.txt:1"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			txs, err := parseRegister("register.txt", []byte(c.register))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describePostings(txs); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got postings\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(c.want, "\n"))
+			}
+			if !isRegister([]byte(c.register)) {
+				t.Error("not recognized as register output")
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// configPollInterval is how often the configuration file is checked for
+// changes in long running modes
+const configPollInterval = 2 * time.Second
+
+// settingsMu guards the flags in long running modes, where reloads change
+// them
+var settingsMu sync.RWMutex
+
+// streamWithReload serves -stream, with the settings reloaded whenever a
+// configuration file changes (or on SIGHUP) and the effective configuration
+// logged on SIGUSR1. txs are all the transactions read for the default
+// workspace, before any filter.
+func streamWithReload(txs map[amountKey][]Tx, onCommandLine map[string]bool) error {
+	filtered := func() (map[amountKey][]Tx, *script, error) {
+		current := copyTxs(txs)
+		if *scriptPath == "" {
+			return current, nil, nil
+		}
+		s, err := loadScript(*scriptPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := s.filter(current); err != nil {
+			return nil, nil, err
+		}
+		return current, s, nil
+	}
+
+	current, s, err := filtered()
+	if err != nil {
+		return err
+	}
+	scan, err := scanSettings(*days, s)
+	if err != nil {
+		return err
+	}
+	ws := Workspaces{"": newIndex(scan, current)}
+	for name, config := range workspaces {
+		if ws[name], err = loadWorkspace(config); err != nil {
+			return fmt.Errorf("workspace %v: %w", name, err)
+		}
+	}
+
+	path, explicit := *configPath, onCommandLine["config"]
+	applied, _ := readConfig(path, flag.CommandLine, explicit)
+	reload := func() {
+		settingsMu.Lock()
+		defer settingsMu.Unlock()
+		settings, err := readConfig(path, flag.CommandLine, explicit)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("could not reload configuration, keeping the previous one", "err", err)
+			return
+		}
+		// Settings removed from the file go back to their default
+		restore := func(err error) {
+			slog.Error("could not reload configuration, keeping the previous one", "err", err)
+			if err := setConfig(applied, onCommandLine); err != nil {
+				slog.Error("could not restore the previous configuration", "err", err)
+			}
+		}
+		if err := setConfig(settings, onCommandLine); err != nil {
+			restore(err)
+			return
+		}
+		current, s, err := filtered()
+		if err != nil {
+			restore(err)
+			return
+		}
+		// Matchers and ignore settings too follow the new flags
+		scan, err := scanSettings(*days, s)
+		if err != nil {
+			restore(err)
+			return
+		}
+		applied = settings
+		ws[""].reset(scan, current)
+		for name, config := range workspaces {
+			if ws[name] == nil {
+				slog.Warn("new workspaces are only served after a restart", "workspace", name)
+				continue
+			}
+			idx, err := loadWorkspace(config)
+			if err != nil {
+				slog.Error("could not reload workspace, keeping the previous one", "workspace", name, "err", err)
+				continue
+			}
+			ws[name].replace(idx)
+		}
+		slog.Info("configuration reloaded", "file", path)
+	}
+
+	// Reloads run one at a time, those asked for meanwhile coalescing
+	// into the next one
+	reloads := make(chan struct{}, 1)
+	requestReload := func() {
+		select {
+		case reloads <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		for range reloads {
+			reload()
+		}
+	}()
+	go watchConfig(path, configPollInterval, requestReload)
+	for _, config := range workspaces {
+		go watchConfig(config, configPollInterval, requestReload)
+	}
+	notifySignals(requestReload, func() {
+		settingsMu.RLock()
+		defer settingsMu.RUnlock()
+		logConfig(flag.CommandLine)
+	})
+
+	return ws.stream(*streamPath)
+}
+
+// setConfig sets the flags to their default, then to settings, but those in
+// onCommandLine
+func setConfig(settings []setting, onCommandLine map[string]bool) error {
+	if err := resetFlags(flag.CommandLine, onCommandLine); err != nil {
+		return err
+	}
+	return applyConfig(flag.CommandLine, settings, onCommandLine)
+}
+
+// copyTxs returns a copy of txs that can be filtered without altering txs
+func copyTxs(txs map[amountKey][]Tx) map[amountKey][]Tx {
+	c := make(map[amountKey][]Tx, len(txs))
+	for amount, bucket := range txs {
+		c[amount] = append([]Tx(nil), bucket...)
+	}
+	return c
+}
+
+// watchConfig calls reload whenever the modification time of the file at
+// path changes, checking every interval
+func watchConfig(path string, interval time.Duration, reload func()) {
+	var last time.Time
+	if fi, err := os.Stat(path); err == nil {
+		last = fi.ModTime()
+	}
+	for range time.Tick(interval) {
+		fi, err := os.Stat(path)
+		if err != nil || fi.ModTime().Equal(last) {
+			continue
+		}
+		last = fi.ModTime()
+		reload()
+	}
+}
+
+// logConfig logs the current value of every flag
+func logConfig(fs *flag.FlagSet) {
+	var attrs []any
+	fs.VisitAll(func(f *flag.Flag) {
+		attrs = append(attrs, f.Name, f.Value.String())
+	})
+	slog.Info("effective configuration", attrs...)
+}
@@ -0,0 +1,566 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"zgo.at/zli"
+)
+
+var format = flag.String("format", "text", "format of the report: text, json, sonar (SonarQube generic issues), junit, tap (Test Anything Protocol) or review (by month and account); json@1 pins the version of the json schema")
+
+var expand = flag.Bool("expand", false, "list every posting of recurring series in the text report, instead of a line for each series")
+
+// schemaVersion is the version of the json report and of stream verdicts. It
+// is only increased when fields are removed or change meaning, not when they
+// are added.
+const schemaVersion = 1
+
+// A finding is a group of postings to report, or a problem at a line of a
+// journal
+type finding struct {
+	// rule identifies the check, like "duplicate"
+	rule  string
+	title string
+	txs   []*Tx
+	// For problems not about postings
+	message string
+	file    string
+	line    int
+	// status is the state of the finding, with -state
+	status *findingStatus
+}
+
+// label returns the title of f followed by its state, if any, for reports
+// with no field of their own for it
+func (f *finding) label() string {
+	if f.status == nil {
+		return f.title
+	}
+	return fmt.Sprintf("%v [%v %v, first seen %v]", f.title, f.status.State, f.id(), f.status.age())
+}
+
+// formats are the report formats, printing findings on stdout. Postings are
+// in inputFile when they have no file of their own.
+var formats = map[string]func(ignoredTag, inputFile string, findings []finding) error{
+	"text":   printText,
+	"json":   printJSON,
+	"sonar":  printSonar,
+	"junit":  printJUnit,
+	"tap":    printTAP,
+	"review": printReview,
+}
+
+// reportFormat returns the printer of the format name, possibly pinned to a
+// version of the schema like json@1
+func reportFormat(name string) (func(ignoredTag, inputFile string, findings []finding) error, error) {
+	name, pinned, isPinned := strings.Cut(name, "@")
+	printer := formats[name]
+	if printer == nil {
+		return nil, fmt.Errorf("unknown report format %q", name)
+	}
+	if isPinned {
+		if name != "json" {
+			return nil, fmt.Errorf("format %v has no schema versions to pin", name)
+		}
+		if v, err := strconv.Atoi(pinned); err != nil || v < 1 || v > schemaVersion {
+			return nil, fmt.Errorf("unsupported %v schema version %q, the latest being %v", name, pinned, schemaVersion)
+		}
+	}
+	return printer, nil
+}
+
+// printText prints findings as ledger comments and postings. With several
+// commodities, findings are in a section for each, with the total amount of
+// its duplicates.
+func printText(ignoredTag, inputFile string, findings []finding) error {
+	printHeader("; ")
+	sections := make(map[string][]finding)
+	var commodities []string
+	for _, f := range findings {
+		c, _ := f.commodity()
+		if _, exists := sections[c]; !exists {
+			commodities = append(commodities, c)
+		}
+		sections[c] = append(sections[c], f)
+	}
+	if len(commodities) <= 1 {
+		printFindings(ignoredTag, findings)
+		return nil
+	}
+	// Findings in several commodities or without postings last
+	sort.Slice(commodities, func(i, j int) bool {
+		if commodities[i] == "" || commodities[j] == "" {
+			return commodities[j] == ""
+		}
+		return commodities[i] < commodities[j]
+	})
+	for _, c := range commodities {
+		if c == "" {
+			fmt.Print(zli.Bold, "; == Other findings ==", zli.Reset, "\n")
+		} else {
+			header := fmt.Sprintf("%v: %v findings", c, len(sections[c]))
+			if len(sections[c]) == 1 {
+				header = fmt.Sprintf("%v: 1 finding", c)
+			}
+			// What would be removed, keeping the first posting of each
+			// group of duplicates. Only positive postings are counted,
+			// both sides of a transaction being found.
+			duplicated := new(big.Rat)
+			for _, f := range sections[c] {
+				if f.rule != "duplicate" || f.txs[0].exact().Sign() < 0 {
+					continue
+				}
+				for _, tx := range f.txs[1:] {
+					duplicated.Add(duplicated, tx.exact())
+				}
+			}
+			if duplicated.Sign() > 0 {
+				header += fmt.Sprintf(", %v possibly duplicated", decimalString(duplicated))
+			}
+			fmt.Print(zli.Bold, "; == ", header, " ==", zli.Reset, "\n")
+		}
+		printFindings(ignoredTag, sections[c])
+	}
+	return nil
+}
+
+// commodity returns the commodity of the postings of f, if they all have the
+// same
+func (f *finding) commodity() (string, bool) {
+	if len(f.txs) == 0 {
+		return "", false
+	}
+	for _, tx := range f.txs[1:] {
+		if tx.Commodity != f.txs[0].Commodity {
+			return "", false
+		}
+	}
+	return f.txs[0].Commodity, f.txs[0].Commodity != ""
+}
+
+func printFindings(ignoredTag string, findings []finding) {
+	title := ""
+	for _, f := range findings {
+		if series, ok := recurring(f.txs); ok && !*expand {
+			fmt.Print(zli.BrightBlack|zli.White.Bg(), "; ", f.label(), ":", zli.Reset, "\n")
+			fmt.Printf("(%v)\trecurring: %v\n", f.txs[0].position(), series)
+			continue
+		}
+		if f.txs != nil {
+			printGroup(f.label(), ignoredTag, f.txs...)
+			continue
+		}
+		if f.label() != title {
+			title = f.label()
+			fmt.Printf("; %v:\n", title)
+		}
+		fmt.Printf("%v:%v: %v\n", f.file, f.line, f.message)
+	}
+}
+
+// A period of recurring postings
+type period struct {
+	name string
+	// shortest and longest are the numbers of days between postings
+	shortest, longest int
+	// slot numbers the periods, for each date to be in one
+	slot func(time.Time) int
+}
+
+// Postings a few days apart are what duplicates look like, so only calendar
+// periods count, months and years varying by up to 3 days
+var periods = []period{
+	{"weekly", 6, 8, func(t time.Time) int { return int(t.Unix() / (7 * 24 * 3600)) }},
+	{"every two weeks", 13, 15, func(t time.Time) int { return int(t.Unix() / (14 * 24 * 3600)) }},
+	{"monthly", 28, 31, func(t time.Time) int { return 12*t.Year() + int(t.Month()) }},
+	{"quarterly", 89, 92, func(t time.Time) int { return 4*t.Year() + (int(t.Month())-1)/3 }},
+	{"yearly", 365, 366, func(t time.Time) int { return t.Year() }},
+}
+
+// recurring describes txs when they are at least three postings with the
+// same payee, account and amount, spaced by a week, a month, a year..., like
+// "12 × 9.99 monthly at Spotify on Expenses:Music, 2021-01-05 to 2021-12-05"
+func recurring(txs []*Tx) (string, bool) {
+	if len(txs) < 3 {
+		return "", false
+	}
+	sorted := append([]*Tx(nil), txs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+	first := sorted[0]
+	shortest, longest := math.MaxInt, 0
+	for i, tx := range sorted[1:] {
+		if !strings.EqualFold(tx.Payee, first.Payee) || tx.Account != first.Account || tx.key() != first.key() {
+			return "", false
+		}
+		days := daysApart(sorted[i].Date, tx.Date)
+		shortest, longest = min(shortest, days), max(longest, days)
+	}
+	period := ""
+	for _, p := range periods {
+		if shortest >= p.shortest && longest <= p.longest {
+			period = p.name
+		}
+	}
+	if period == "" {
+		return "", false
+	}
+	last := sorted[len(sorted)-1]
+	return fmt.Sprintf("%v × %v %v at %v on %v, %v to %v", len(sorted), first.Amount, period, first.Payee, first.Account,
+		first.Date.Format("2006-01-02"), last.Date.Format("2006-01-02")), true
+}
+
+// describe returns a one line description of tx
+func (tx *Tx) describe() string {
+	return fmt.Sprintf("%v %v%v %v %v", tx.Date.Format("2006-01-02"), tx.mark(), tx.Payee, tx.Account, tx.Amount)
+}
+
+// location returns the file of tx and its line, if known
+func (tx *Tx) location(inputFile string) (string, int) {
+	switch {
+	case tx.File != "":
+		return tx.File, tx.Line
+	case tx.Input != "":
+		return tx.Input, 0
+	}
+	return inputFile, 0
+}
+
+// where returns the location of tx, as file:line or as its position in file
+func (tx *Tx) where(inputFile string) string {
+	file, line := tx.location(inputFile)
+	if line > 0 {
+		return fmt.Sprintf("%v:%v", file, line)
+	}
+	return fmt.Sprintf("%v transaction %v", file, tx.Position)
+}
+
+type sonarLocation struct {
+	Message   string `json:"message"`
+	FilePath  string `json:"filePath"`
+	TextRange *struct {
+		StartLine int `json:"startLine"`
+	} `json:"textRange,omitempty"`
+}
+
+func newSonarLocation(message, file string, line int) sonarLocation {
+	l := sonarLocation{Message: message, FilePath: file}
+	if line > 0 {
+		l.TextRange = &struct {
+			StartLine int `json:"startLine"`
+		}{line}
+	}
+	return l
+}
+
+type sonarIssue struct {
+	EngineID           string          `json:"engineId"`
+	RuleID             string          `json:"ruleId"`
+	Severity           string          `json:"severity"`
+	Type               string          `json:"type"`
+	PrimaryLocation    sonarLocation   `json:"primaryLocation"`
+	SecondaryLocations []sonarLocation `json:"secondaryLocations,omitempty"`
+}
+
+// withHelpURL points the message of issue to the documentation of its rule
+func withHelpURL(issue sonarIssue) sonarIssue {
+	if _, url := ruleHelp(issue.RuleID); url != "" {
+		issue.PrimaryLocation.Message += ", see " + url
+	}
+	return issue
+}
+
+// printSonar prints findings in the generic issue import format of SonarQube
+func printSonar(ignoredTag, inputFile string, findings []finding) error {
+	issues := []sonarIssue{}
+	for _, f := range findings {
+		issue := sonarIssue{
+			EngineID: "ledger-lint-duplicate",
+			RuleID:   f.rule,
+			Severity: "MINOR",
+			Type:     "CODE_SMELL",
+		}
+		switch f.rule {
+		case "duplicate", "time-overlap", "subscription", "balance-assertion":
+			issue.Severity, issue.Type = "MAJOR", "BUG"
+		}
+		if f.txs == nil {
+			issue.PrimaryLocation = newSonarLocation(f.message, f.file, f.line)
+			issues = append(issues, withHelpURL(issue))
+			continue
+		}
+		for i, tx := range f.txs {
+			file, line := tx.location(inputFile)
+			l := newSonarLocation(fmt.Sprintf("%v: %v", f.label(), tx.describe()), file, line)
+			if i == 0 {
+				issue.PrimaryLocation = l
+			} else {
+				issue.SecondaryLocations = append(issue.SecondaryLocations, l)
+			}
+		}
+		issues = append(issues, withHelpURL(issue))
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Issues []sonarIssue `json:"issues"`
+	}{issues})
+}
+
+type jsonFinding struct {
+	Rule        string `json:"rule"`
+	Title       string `json:"title"`
+	Fingerprint string `json:"fingerprint"`
+	// State is that of -state
+	State    *findingStatus `json:"state,omitempty"`
+	Postings []*Tx          `json:"postings,omitempty"`
+	Message  string         `json:"message,omitempty"`
+	File     string         `json:"file,omitempty"`
+	Line     int            `json:"line,omitempty"`
+	Help     string         `json:"help,omitempty"`
+	HelpURL  string         `json:"help_url,omitempty"`
+}
+
+// printJSON prints findings as a JSON object, with the version of its schema
+func printJSON(ignoredTag, inputFile string, findings []finding) error {
+	report := struct {
+		Version  int           `json:"version"`
+		Run      *runInfo      `json:"run,omitempty"`
+		Findings []jsonFinding `json:"findings"`
+	}{schemaVersion, runHeader, []jsonFinding{}}
+	for _, f := range findings {
+		help, url := ruleHelp(f.rule)
+		report.Findings = append(report.Findings, jsonFinding{
+			Rule:        f.rule,
+			Title:       f.title,
+			Fingerprint: f.id(),
+			State:       f.status,
+			Postings:    f.txs,
+			Message:     f.message,
+			File:        f.file,
+			Line:        f.line,
+			Help:        help,
+			HelpURL:     url,
+		})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+type junitTestCase struct {
+	ClassName string `xml:"classname,attr"`
+	Name      string `xml:"name,attr"`
+	Failure   struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	} `xml:"failure"`
+}
+
+// printJUnit prints findings as a JUnit XML report, each of them a failed
+// test case
+func printJUnit(ignoredTag, inputFile string, findings []finding) error {
+	type property struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	}
+	type suite struct {
+		Name       string          `xml:"name,attr"`
+		Tests      int             `xml:"tests,attr"`
+		Failures   int             `xml:"failures,attr"`
+		Properties []property      `xml:"properties>property,omitempty"`
+		TestCases  []junitTestCase `xml:"testcase"`
+	}
+	report := struct {
+		XMLName xml.Name `xml:"testsuites"`
+		Suite   suite    `xml:"testsuite"`
+	}{Suite: suite{Name: "ledger-lint-duplicate", Tests: len(findings), Failures: len(findings)}}
+	if runHeader != nil {
+		report.Suite.Properties = append(report.Suite.Properties,
+			property{"version", runHeader.Version}, property{"duration", runHeader.Duration})
+		for _, input := range runHeader.Inputs {
+			report.Suite.Properties = append(report.Suite.Properties, property{"input " + input.File, input.SHA256})
+		}
+		for name, value := range runHeader.Settings {
+			report.Suite.Properties = append(report.Suite.Properties, property{"setting " + name, value})
+		}
+		sort.SliceStable(report.Suite.Properties[2:], func(i, j int) bool {
+			return report.Suite.Properties[2+i].Name < report.Suite.Properties[2+j].Name
+		})
+	}
+
+	for _, f := range findings {
+		c := junitTestCase{ClassName: f.rule}
+		c.Failure.Message = f.label()
+		if f.txs == nil {
+			c.Name = fmt.Sprintf("%v:%v", f.file, f.line)
+			c.Failure.Text = f.message
+		} else {
+			c.Name = fmt.Sprintf("%v: %v", f.txs[0].where(inputFile), f.txs[0].describe())
+			var lines []string
+			for _, tx := range f.txs {
+				lines = append(lines, fmt.Sprintf("%v: %v", tx.where(inputFile), tx.describe()))
+			}
+			c.Failure.Text = strings.Join(lines, "\n")
+		}
+		if help, url := ruleHelp(f.rule); help != "" {
+			c.Failure.Text += fmt.Sprintf("\n\n%v\nSee %v", help, url)
+		}
+		report.Suite.TestCases = append(report.Suite.TestCases, c)
+	}
+
+	fmt.Print(xml.Header)
+	enc := xml.NewEncoder(os.Stdout)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	fmt.Println()
+	return nil
+}
+
+// printTAP prints findings in the Test Anything Protocol, each of them a
+// failed test with its postings as diagnostics
+func printTAP(ignoredTag, inputFile string, findings []finding) error {
+	fmt.Println("TAP version 13")
+	printHeader("# ")
+	if len(findings) == 0 {
+		fmt.Println("1..1")
+		fmt.Println("ok 1 - no findings")
+		return nil
+	}
+	fmt.Printf("1..%v\n", len(findings))
+	for i, f := range findings {
+		fmt.Printf("not ok %v - %v: %v\n", i+1, f.rule, f.label())
+		fmt.Println("  ---")
+		if f.txs == nil {
+			fmt.Printf("  at: %q\n  message: %q\n", fmt.Sprintf("%v:%v", f.file, f.line), f.message)
+		} else {
+			fmt.Println("  postings:")
+			for _, tx := range f.txs {
+				fmt.Printf("    - %q\n", fmt.Sprintf("%v: %v", tx.where(inputFile), tx.describe()))
+			}
+		}
+		if help, url := ruleHelp(f.rule); help != "" {
+			fmt.Printf("  help: %q\n  url: %q\n", help, url)
+		}
+		fmt.Println("  ...")
+	}
+	return nil
+}
+
+// printReview prints the postings of findings by month, account and
+// commodity, with subtotals and running balances by account and commodity,
+// and boxes to tick them off
+func printReview(ignoredTag, inputFile string, findings []finding) error {
+	type item struct {
+		tx     *Tx
+		titles []string
+	}
+	// A posting in several findings is listed once
+	type key struct {
+		where, account string
+		amount         amountKey
+	}
+	items := make(map[key]*item)
+	var all []*item
+	for _, f := range findings {
+		for _, tx := range f.txs {
+			k := key{tx.where(inputFile), tx.Account, tx.key()}
+			if i, exists := items[k]; exists {
+				if !containsString(i.titles, f.label()) {
+					i.titles = append(i.titles, f.label())
+				}
+				continue
+			}
+			items[k] = &item{tx, []string{f.label()}}
+			all = append(all, items[k])
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		a, b := all[i].tx, all[j].tx
+		if ma, mb := a.Date.Format("2006-01"), b.Date.Format("2006-01"); ma != mb {
+			return ma < mb
+		}
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		if a.Commodity != b.Commodity {
+			return a.Commodity < b.Commodity
+		}
+		return a.Date.Before(b.Date)
+	})
+
+	printHeader("; ")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	// Amounts in different commodities are never added up
+	type balance struct{ account, commodity string }
+	running := make(map[balance]*big.Rat)
+	var month string
+	var current balance
+	subtotal := new(big.Rat)
+	endBalance := func() {
+		if current.account != "" {
+			fmt.Fprintf(w, "    Subtotal\t\t%v\t%10v\t\t\n", current.commodity, decimalString(subtotal))
+		}
+	}
+	for _, i := range all {
+		tx := i.tx
+		b := balance{tx.Account, tx.Commodity}
+		if m := tx.Date.Format("2006-01"); m != month || b != current {
+			endBalance()
+			if m != month {
+				fmt.Fprintf(w, "%v\n", m)
+			}
+			if m != month || b.account != current.account {
+				fmt.Fprintf(w, "  %v\n", b.account)
+			}
+			month, current, subtotal = m, b, new(big.Rat)
+		}
+		if running[b] == nil {
+			running[b] = new(big.Rat)
+		}
+		subtotal.Add(subtotal, tx.exact())
+		running[b].Add(running[b], tx.exact())
+		fmt.Fprintf(w, "    [ ] %v\t%v%v\t%v\t%10v\t%10v\t%v (%v)\n",
+			tx.Date.Format("2006-01-02"), tx.mark(), tx.Payee, tx.Commodity, tx.quantity(), decimalString(running[b]),
+			strings.Join(i.titles, ", "), tx.where(inputFile))
+	}
+	endBalance()
+	for _, f := range findings {
+		if f.txs == nil {
+			fmt.Fprintf(w, "[ ] %v:%v: %v\n", f.file, f.line, f.message)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,131 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// keys returns the keys of the JSON object o, sorted
+func keys(o map[string]json.RawMessage) []string {
+	var k []string
+	for key := range o {
+		k = append(k, key)
+	}
+	sort.Strings(k)
+	return k
+}
+
+func TestJSONReport(t *testing.T) {
+	dir := t.TempDir()
+	journal := filepath.Join(dir, "main.ledger")
+	err := os.WriteFile(journal, []byte(`2024/03/01 * Shop
+    Expenses:Food  10.10 EUR  ; :trip:
+    Assets:Bank
+
+2024/03/02 Shop
+    Expenses:Food  10.10 EUR
+    Assets:Bank
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		args []string
+		// Keys of the report, of its first finding and of the postings of
+		// that finding
+		report, finding []string
+		postings        [][]string
+	}{
+		{"json", []string{"-format", "json"},
+			[]string{"findings", "version"},
+			[]string{"fingerprint", "help", "help_url", "postings", "rule", "title"},
+			[][]string{
+				{"account", "amount", "commodity", "date", "file", "line", "note", "payee", "position", "posting_tags", "state"},
+				{"account", "amount", "commodity", "date", "file", "line", "payee", "position"},
+			}},
+		{"pinned, with state and header", []string{"-format", "json@1", "-state", filepath.Join(dir, "state.json"), "-header"},
+			[]string{"findings", "run", "version"},
+			[]string{"fingerprint", "help", "help_url", "postings", "rule", "state", "title"},
+			[][]string{
+				{"account", "amount", "commodity", "date", "file", "line", "note", "payee", "position", "posting_tags", "state"},
+				{"account", "amount", "commodity", "date", "file", "line", "payee", "position"},
+			}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out := runCommand(t, append(append([]string{"-parser", "native"}, c.args...), journal)...)
+			var report map[string]json.RawMessage
+			if err := json.Unmarshal(out, &report); err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			if got := keys(report); !reflect.DeepEqual(got, c.report) {
+				t.Errorf("got report keys %v, want %v", got, c.report)
+			}
+			if string(report["version"]) != "1" {
+				t.Errorf("got version %s, want 1", report["version"])
+			}
+			var findings []map[string]json.RawMessage
+			if err := json.Unmarshal(report["findings"], &findings); err != nil {
+				t.Fatal(err)
+			}
+			if len(findings) != 2 {
+				t.Fatalf("got %v findings, want 2, for both accounts", len(findings))
+			}
+			f := findings[1]
+			if got := keys(f); !reflect.DeepEqual(got, c.finding) {
+				t.Errorf("got finding keys %v, want %v", got, c.finding)
+			}
+			if string(f["rule"]) != `"duplicate"` {
+				t.Errorf("got rule %s, want duplicate", f["rule"])
+			}
+			if state, exists := f["state"]; exists {
+				var status map[string]json.RawMessage
+				if err := json.Unmarshal(state, &status); err != nil {
+					t.Fatal(err)
+				}
+				if got := keys(status); !reflect.DeepEqual(got, []string{"days", "first_seen", "state"}) || string(status["state"]) != `"new"` {
+					t.Errorf("got state %s", state)
+				}
+			}
+			var postings []map[string]json.RawMessage
+			if err := json.Unmarshal(f["postings"], &postings); err != nil {
+				t.Fatal(err)
+			}
+			if len(postings) != len(c.postings) {
+				t.Fatalf("got %v postings, want %v", len(postings), len(c.postings))
+			}
+			for i, p := range postings {
+				if got := keys(p); !reflect.DeepEqual(got, c.postings[i]) {
+					t.Errorf("got keys %v of posting %v, want %v", got, i, c.postings[i])
+				}
+				// The exact decimal, as a number
+				if !bytes.Equal(p["amount"], []byte("10.1")) {
+					t.Errorf("got amount %s of posting %v, want 10.1", p["amount"], i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var explainRule = flag.String("explain-rule", "", "print what the findings of the rule with this `id`, like duplicate, mean and how to silence them, and exit")
+
+// rulesURL is where the rules are documented, each under a heading named
+// after its id
+const rulesURL = "https://github.com/cljoly/ledger-lint-duplicate#"
+
+// A ruleDoc explains the findings of a rule, in machine reports and with
+// -explain-rule
+type ruleDoc struct {
+	// meaning is what a finding says about the postings
+	meaning string
+	// silence is how to stop a finding from being reported
+	silence string
+}
+
+// ruleDocs are the explanations of rules, by id. The ids are stable, being
+// used in the ignore file, in -state and by CI tools.
+var ruleDocs = map[string]ruleDoc{
+	"duplicate": {
+		"Postings to the same account with the same amount, within -days of each other, that may have been entered twice.",
+		"Tag all of them with the -ignore-tag (notDup by default), give one the -ignore-metadata key (not-duplicate: true), or add the fingerprint to the ignore file.",
+	},
+	"time-overlap": {
+		"Timeclock sessions overlapping each other, time spent twice.",
+		"Fix the check-in or check-out times, or add the fingerprint to the ignore file.",
+	},
+	"subscription": {
+		"Several charges to the same account in a month from a subscription payee, given with -subscriptions or with a transaction having the -subscription-tag.",
+		"Tag the charges with the -ignore-tag, stop treating the payee as a subscription if it can charge more often, or add the fingerprint to the ignore file.",
+	},
+	"note": {
+		"Distinct transactions with the same note within -days of each other, even with different amounts, with -check-notes.",
+		"Make the notes different, tag the transactions with the -ignore-tag, or add the fingerprint to the ignore file.",
+	},
+	"required-tag": {
+		"Postings to an account given with -require-tag without the tag.",
+		"Add the tag to the postings, or add the fingerprint to the ignore file.",
+	},
+	"account-depth": {
+		"Postings to accounts with more levels than -max-account-depth.",
+		"Move the postings to a shallower account, or raise -max-account-depth.",
+	},
+	"account-name": {
+		"Postings to accounts with a level not matching -account-pattern.",
+		"Rename the account, or loosen -account-pattern.",
+	},
+	"commodity": {
+		"A posting in a commodity new to its account, with -check-commodities, often a typo.",
+		"Fix the commodity, or add the fingerprint to the ignore file once the new commodity is expected.",
+	},
+	"balance-assertion": {
+		"Balance assertions of an account with different values on the same day, with -check-assertions.",
+		"Fix or remove one of the assertions.",
+	},
+	"undeclared": {
+		"Postings to accounts or in commodities not declared with account or commodity directives, with -strict.",
+		"Declare the account or commodity in the journal, or fix its name.",
+	},
+	"alias": {
+		"Account aliases sharing a target, or payee aliases with several targets, with -check-aliases.",
+		"Remove or merge the conflicting aliases.",
+	},
+}
+
+// ruleHelp returns the explanation of rule and the address of its
+// documentation
+func ruleHelp(rule string) (help, url string) {
+	doc, exists := ruleDocs[rule]
+	if !exists {
+		return "", ""
+	}
+	return doc.meaning + " " + doc.silence, rulesURL + rule
+}
+
+// printRule prints the explanation of rule for -explain-rule, or reports
+// that it does not exist
+func printRule(rule string) {
+	doc, exists := ruleDocs[rule]
+	if !exists {
+		var ids []string
+		for id := range ruleDocs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		usageError(fmt.Sprintf("unknown rule %q, rules are %v", rule, strings.Join(ids, ", ")))
+	}
+	fmt.Printf("%v\n\n%v\n\nTo silence it: %v\n\nSee %v\n", rule, doc.meaning, doc.silence, rulesURL+rule)
+}
@@ -0,0 +1,142 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var withHeader = flag.Bool("header", false, "start reports with the version of the tool, the inputs and their hashes, the settings and the duration of the scan, all but sonar")
+
+// runHeader describes the run in reports, when -header is given
+var runHeader *runInfo
+
+// runInfo describes a run, for a saved report to tell how to reproduce it
+type runInfo struct {
+	Version string      `json:"version"`
+	Inputs  []inputInfo `json:"inputs"`
+	// Settings are the flags set on the command line or in the
+	// configuration, by name
+	Settings map[string]string `json:"settings,omitempty"`
+	Duration string            `json:"duration"`
+}
+
+type inputInfo struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// toolVersion returns the version of the module, or its commit when built
+// from a checkout with go build
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	version := "devel"
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			version += " " + s.Value
+		}
+		if s.Key == "vcs.modified" && s.Value == "true" {
+			version += " modified"
+		}
+	}
+	return version
+}
+
+// newRunInfo describes the run that started at start, on fileNames, with the
+// flags of fs set
+func newRunInfo(start time.Time, fileNames []string, fs *flag.FlagSet) (*runInfo, error) {
+	run := &runInfo{Version: toolVersion(), Settings: make(map[string]string)}
+	for _, fileName := range fileNames {
+		b, err := readInput(fileName)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		run.Inputs = append(run.Inputs, inputInfo{fileName, hex.EncodeToString(sum[:])})
+	}
+	fs.Visit(func(f *flag.Flag) {
+		run.Settings[f.Name] = f.Value.String()
+		if strings.Contains(f.Name, "token") || strings.Contains(f.Name, "secret") {
+			run.Settings[f.Name] = "redacted"
+		}
+	})
+	run.Duration = time.Since(start).Round(time.Millisecond).String()
+	return run, nil
+}
+
+// anonymized returns a copy of run with the names of inputs and the values of
+// settings, other than numbers and booleans, anonymized by a
+func (run *runInfo) anonymized(a *anonymizer) *runInfo {
+	anonymized := *run
+	anonymized.Inputs = nil
+	for _, input := range run.Inputs {
+		anonymized.Inputs = append(anonymized.Inputs, inputInfo{a.file(input.File), input.SHA256})
+	}
+	anonymized.Settings = make(map[string]string, len(run.Settings))
+	for name, value := range run.Settings {
+		_, notNumber := strconv.ParseFloat(value, 64)
+		_, notBool := strconv.ParseBool(value)
+		if notNumber != nil && notBool != nil {
+			value = a.text(value)
+		}
+		anonymized.Settings[name] = value
+	}
+	return &anonymized
+}
+
+// lines returns the description of run as lines of text
+func (run *runInfo) lines() []string {
+	lines := []string{fmt.Sprintf("ledger-lint-duplicate %v, scanned in %v", run.Version, run.Duration)}
+	for _, input := range run.Inputs {
+		lines = append(lines, fmt.Sprintf("input %v sha256 %v", input.File, input.SHA256))
+	}
+	names := make([]string, 0, len(run.Settings))
+	for name := range run.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("setting %v = %v", name, run.Settings[name]))
+	}
+	return lines
+}
+
+// printHeader prints the lines of runHeader, if any, after prefix
+func printHeader(prefix string) {
+	if runHeader == nil {
+		return
+	}
+	for _, line := range runHeader.lines() {
+		fmt.Println(prefix + line)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sampleFlag is a fraction, given as a percentage like 10% or as a number
+// like 0.1
+type sampleFlag float64
+
+func (s *sampleFlag) String() string {
+	return strconv.FormatFloat(float64(*s)*100, 'f', -1, 64) + "%"
+}
+
+func (s *sampleFlag) Set(value string) error {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(value, "%") {
+		f /= 100
+	}
+	if f <= 0 || f > 1 {
+		return fmt.Errorf("sample %v not in (0%%, 100%%]", value)
+	}
+	*s = sampleFlag(f)
+	return nil
+}
+
+var sample sampleFlag = 1
+var sampleSeed = flag.Int64("sample-seed", 0, "`seed` of the random choice of buckets with -sample, 0 for a new one each run")
+
+func init() {
+	flag.Var(&sample, "sample", "only search this `fraction` of the amounts, like 10%, chosen at random, for a quick estimate of the number of duplicates")
+}
+
+// sampleBuckets returns a random fraction of the buckets of txs with more
+// than one posting, the others having no duplicates, and their total number
+func sampleBuckets(txs map[amountKey][]Tx, fraction float64, seed int64) (sampled map[amountKey][]Tx, population int) {
+	var amounts []amountKey
+	// For the seed to give the same sample
+	for _, amount := range sortedKeys(txs) {
+		if len(txs[amount]) > 1 {
+			amounts = append(amounts, amount)
+		}
+	}
+	rand.New(rand.NewSource(seed)).Shuffle(len(amounts), func(i, j int) {
+		amounts[i], amounts[j] = amounts[j], amounts[i]
+	})
+	sampled = make(map[amountKey][]Tx)
+	for _, amount := range amounts[:int(math.Ceil(fraction*float64(len(amounts))))] {
+		sampled[amount] = txs[amount]
+	}
+	return sampled, len(amounts)
+}
+
+// estimateDuplicates returns the estimated number of groups of duplicates
+// among population buckets from those found in sampled, with the bounds of
+// its 95% confidence interval
+func estimateDuplicates(sampled map[amountKey][]Tx, population int, duplicates [][]*Tx) (estimate, low, high float64) {
+	k := float64(len(sampled))
+	if k == 0 {
+		return 0, 0, 0
+	}
+	// Groups are counted by the bucket of their first posting
+	bucketOf := make(map[amountKey]amountKey)
+	for start, bucket := range sampled {
+		for _, tx := range bucket {
+			bucketOf[tx.key()] = start
+		}
+	}
+	counts := make(map[amountKey]float64)
+	for _, group := range duplicates {
+		counts[bucketOf[group[0].key()]]++
+	}
+	mean := float64(len(duplicates)) / k
+	var squares float64
+	for start := range sampled {
+		squares += (counts[start] - mean) * (counts[start] - mean)
+	}
+	n := float64(population)
+	estimate = n * mean
+	if k < 2 {
+		return estimate, float64(len(duplicates)), math.Inf(1)
+	}
+	// With the finite population correction
+	se := n * math.Sqrt((1-k/n)*squares/(k-1)/k)
+	return estimate, math.Max(estimate-1.96*se, float64(len(duplicates))), estimate + 1.96*se
+}
+
+// sampleSearch returns the buckets of txs to search with -sample, logging
+// the estimate of the number of duplicates through report once known
+func sampleSearch(txs map[amountKey][]Tx) (sampled map[amountKey][]Tx, report func(duplicates [][]*Tx)) {
+	seed := *sampleSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	sampled, population := sampleBuckets(txs, float64(sample), seed)
+	return sampled, func(duplicates [][]*Tx) {
+		estimate, low, high := estimateDuplicates(sampled, population, duplicates)
+		slog.Info("sampled amounts", "sample", sample.String(), "seed", seed, "amounts", len(sampled), "of", population,
+			"found", len(duplicates), "estimated", math.Round(estimate), "low", math.Round(low), "high", math.Round(high))
+	}
+}
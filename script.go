@@ -0,0 +1,140 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// maxScriptSteps bounds each call to a script function, so that a buggy
+// script cannot hang the scan
+const maxScriptSteps = 1000000
+
+// script holds the functions of a user provided Starlark file:
+//
+//	def keep(tx): return True to check tx, False to leave it out
+//	def similar(a, b): return how similar a and b are, between 0 and 1
+//
+// Both are optional. Starlark has no access to files or the network.
+type script struct {
+	path          string
+	keep, similar starlark.Callable
+}
+
+func loadScript(path string) (*script, error) {
+	thread := &starlark.Thread{Name: path}
+	thread.SetMaxExecutionSteps(maxScriptSteps)
+	globals, err := starlark.ExecFile(thread, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+
+	s := &script{path: path}
+	for name, fn := range map[string]*starlark.Callable{"keep": &s.keep, "similar": &s.similar} {
+		v, ok := globals[name]
+		if !ok {
+			continue
+		}
+		if *fn, ok = v.(starlark.Callable); !ok {
+			return nil, fmt.Errorf("%v: %v is not a function", path, name)
+		}
+	}
+	return s, nil
+}
+
+// call runs fn on its own thread, as calls happen from concurrent workers
+func (s *script) call(fn starlark.Callable, args ...starlark.Value) (starlark.Value, error) {
+	thread := &starlark.Thread{Name: s.path}
+	thread.SetMaxExecutionSteps(maxScriptSteps)
+	v, err := starlark.Call(thread, fn, args, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v: %w", s.path, fn.Name(), err)
+	}
+	return v, nil
+}
+
+// filter returns the transactions of txs for which keep returns true
+func (s *script) filter(txs map[amountKey][]Tx) error {
+	if s.keep == nil {
+		return nil
+	}
+	for amount, bucket := range txs {
+		kept := bucket[:0]
+		for i := range bucket {
+			v, err := s.call(s.keep, txValue(&bucket[i]))
+			if err != nil {
+				return err
+			}
+			if v.Truth() {
+				kept = append(kept, bucket[i])
+			} else {
+				audit("keep(tx) of -script returned false", &bucket[i])
+			}
+		}
+		txs[amount] = kept
+	}
+	return nil
+}
+
+// matcher returns a Matcher calling similar, that matches when the
+// similarity is at least threshold
+func (s *script) matcher(threshold float64) Matcher {
+	return func(a, b *Tx) bool {
+		v, err := s.call(s.similar, txValue(a), txValue(b))
+		if err != nil {
+			fatal(err.Error())
+		}
+		f, ok := starlark.AsFloat(v)
+		if !ok {
+			fatal(fmt.Sprintf("%v: similar returned %v, not a number", s.path, v.Type()))
+		}
+		return f >= threshold
+	}
+}
+
+// txValue exposes tx to scripts as a struct
+func txValue(tx *Tx) starlark.Value {
+	tags := make([]starlark.Value, len(tx.Tags))
+	for i, tag := range tx.Tags {
+		tags[i] = starlark.String(tag)
+	}
+	metadata := starlark.NewDict(len(tx.Metadata))
+	keys := make([]string, 0, len(tx.Metadata))
+	for k := range tx.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		metadata.SetKey(starlark.String(k), starlark.String(tx.Metadata[k]))
+	}
+	return starlarkstruct.FromStringDict(starlark.String("tx"), starlark.StringDict{
+		"date":     starlark.String(tx.Date.Format("2006-01-02")),
+		"position": starlark.MakeInt(tx.Position),
+		"payee":    starlark.String(tx.Payee),
+		"account":  starlark.String(tx.Account),
+		"amount":   starlark.Float(tx.Amount),
+		"tags":     starlark.NewList(tags),
+		"metadata": metadata,
+	})
+}
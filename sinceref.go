@@ -0,0 +1,248 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var sinceRef = flag.String("since-ref", "", "only report findings with postings added to the journals since this git `ref`, like HEAD in a pre-commit hook, or since the unified diff read from stdin with -")
+
+// addedLines are the lines added to journals, by absolute file name
+type addedLines map[string]map[int]bool
+
+// added tells whether the line of file was added
+func (a addedLines) added(file string, line int) bool {
+	if file == "" {
+		return false
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return false
+	}
+	return a[abs][line]
+}
+
+// anyAdded reports whether a posting of txs, or the header of its
+// transaction, was added
+func (a addedLines) anyAdded(txs []*Tx) bool {
+	for _, tx := range txs {
+		if a.added(tx.File, tx.Line) || a.added(tx.File, tx.HeaderLine) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDiff adds to a the lines added by diff, a unified diff whose file
+// names are relative to dir, with or without the a/ and b/ prefixes of git
+func (a addedLines) parseDiff(dir, diff string) error {
+	var file string
+	// Whether the headers of the current file have the prefixes of git
+	var prefixed bool
+	// The next line of the new file, and the lines of each side left in the
+	// current hunk, headers being only read outside of hunks
+	var line, oldLeft, newLeft int
+	for _, l := range strings.Split(diff, "\n") {
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(l, "+"):
+				if file != "" {
+					a[file][line] = true
+				}
+				line++
+				newLeft--
+			case strings.HasPrefix(l, "-"):
+				oldLeft--
+			case strings.HasPrefix(l, "\\"):
+				// \ No newline at end of file
+			default:
+				// A context line, its space being lost by some editors
+				line++
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+		if names, ok := strings.CutPrefix(l, "diff --git "); ok {
+			prefixed = strings.HasPrefix(names, "a/") && strings.Contains(names, " b/")
+			continue
+		}
+		if name, ok := strings.CutPrefix(l, "--- "); ok {
+			name, _, _ = strings.Cut(name, "\t")
+			// A new file is /dev/null on this side, leaving the
+			// diff --git line to tell
+			if name != "/dev/null" {
+				prefixed = strings.HasPrefix(name, "a/")
+			}
+			continue
+		}
+		if name, ok := strings.CutPrefix(l, "+++ "); ok {
+			name, _, _ = strings.Cut(name, "\t")
+			if name == "/dev/null" {
+				file = ""
+				continue
+			}
+			if prefixed {
+				name = strings.TrimPrefix(name, "b/")
+			}
+			abs, err := filepath.Abs(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			file = abs
+			if a[file] == nil {
+				a[file] = make(map[int]bool)
+			}
+			continue
+		}
+		hunk, ok := strings.CutPrefix(l, "@@ ")
+		if !ok {
+			continue
+		}
+		// Like @@ -12,2 +14,3 @@, the count being 1 when left out
+		fields := strings.Fields(hunk)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "-") || !strings.HasPrefix(fields[1], "+") {
+			return fmt.Errorf("invalid hunk header %q", l)
+		}
+		var err error
+		if _, oldLeft, err = hunkRange(fields[0][1:]); err != nil {
+			return fmt.Errorf("invalid hunk header %q: %w", l, err)
+		}
+		if line, newLeft, err = hunkRange(fields[1][1:]); err != nil {
+			return fmt.Errorf("invalid hunk header %q: %w", l, err)
+		}
+	}
+	return nil
+}
+
+// hunkRange parses the start,count range of a side of a hunk header, the
+// count being 1 when left out
+func hunkRange(r string) (start, count int, err error) {
+	first, n, hasCount := strings.Cut(r, ",")
+	if !hasCount {
+		n = "1"
+	}
+	if start, err = strconv.Atoi(first); err != nil {
+		return 0, 0, err
+	}
+	if count, err = strconv.Atoi(n); err != nil {
+		return 0, 0, err
+	}
+	return start, count, nil
+}
+
+// gitAddedLines returns the lines of files added since ref, all those of
+// files git does not track being added
+func gitAddedLines(ref string, files []string) (addedLines, error) {
+	a := make(addedLines)
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Dir(abs)
+		tracked, err := git(dir, "ls-files", "--", abs)
+		if err != nil {
+			return nil, err
+		}
+		if tracked == "" {
+			b, err := ioutil.ReadFile(abs)
+			if err != nil {
+				return nil, err
+			}
+			a[abs] = make(map[int]bool)
+			for line := 1; line <= bytes.Count(b, []byte("\n"))+1; line++ {
+				a[abs][line] = true
+			}
+			continue
+		}
+		diff, err := git(dir, "diff", "--no-color", "--no-ext-diff", "--unified=0", "--src-prefix=a/", "--dst-prefix=b/", "--relative", ref, "--", abs)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.parseDiff(dir, diff); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// loadAddedLines returns the lines added since ref to the journals of the
+// postings of txs, or those of the diff on stdin when ref is stdinFile. Like
+// those of git diff, its file names are relative to the toplevel of the
+// repository, or to the current directory outside of one.
+func loadAddedLines(ref string, txs []*Tx) (addedLines, error) {
+	if ref == stdinFile {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		dir := "."
+		if top, err := git(".", "rev-parse", "--show-toplevel"); err == nil {
+			dir = strings.TrimSpace(top)
+		}
+		a := make(addedLines)
+		return a, a.parseDiff(dir, string(b))
+	}
+	seen := make(map[string]bool)
+	var files []string
+	for _, tx := range txs {
+		if tx.File == "" {
+			return nil, fmt.Errorf("%v: postings are not located in a journal, -since-ref needs the journal", tx.Input)
+		}
+		if !seen[tx.File] {
+			seen[tx.File] = true
+			files = append(files, tx.File)
+		}
+	}
+	return gitAddedLines(ref, files)
+}
+
+// addedGroups returns groups with a posting added since -since-ref
+func addedGroups(a addedLines, groups [][]*Tx) (kept [][]*Tx) {
+	for _, g := range groups {
+		if a.anyAdded(g) {
+			kept = append(kept, g)
+		} else {
+			auditGroup("no posting added since -since-ref", "duplicate", g)
+		}
+	}
+	return kept
+}
+
+// addedFindings returns findings with a posting, or for those not about
+// postings a line, added since -since-ref
+func addedFindings(a addedLines, findings []finding) (kept []finding) {
+	for _, f := range findings {
+		if a.anyAdded(f.txs) || (f.txs == nil && a.added(f.file, f.line)) {
+			kept = append(kept, f)
+		} else {
+			auditGroup("no posting added since -since-ref", f.rule, f.txs)
+		}
+	}
+	return kept
+}
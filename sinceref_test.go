@@ -0,0 +1,114 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		diff string
+		want map[string][]int
+	}{
+		{"git without context", `diff --git a/bank.ledger b/bank.ledger
+index 1111111..2222222 100644
+--- a/bank.ledger
++++ b/bank.ledger
+@@ -3,0 +4,2 @@
++2021/01/02 Shop
++    Expenses:Food  10 EUR
+`, map[string][]int{"bank.ledger": {4, 5}}},
+		{"context lines", `--- bank.ledger
++++ bank.ledger
+@@ -1,3 +1,4 @@
+ 2021/01/01 Shop
+-    Expenses:Food  10 EUR
++    Expenses:Food  12 EUR
++    Assets:Bank
+ 
+`, map[string][]int{"bank.ledger": {2, 3}}},
+		{"added lines like headers", `diff --git a/bank.ledger b/bank.ledger
+--- a/bank.ledger
++++ b/bank.ledger
+@@ -1,2 +1,4 @@
+ 2021/01/01 Shop
++++ comment
++-- comment
+ 2021/01/02 Shop
+`, map[string][]int{"bank.ledger": {2, 3}}},
+		{"new file", `diff --git a/new.ledger b/new.ledger
+new file mode 100644
+--- /dev/null
++++ b/new.ledger
+@@ -0,0 +1 @@
++2021/01/01 Shop
+\ No newline at end of file
+`, map[string][]int{"new.ledger": {1}}},
+		{"deleted file", `diff --git a/old.ledger b/old.ledger
+deleted file mode 100644
+--- a/old.ledger
++++ /dev/null
+@@ -1 +0,0 @@
+-2021/01/01 Shop
+`, map[string][]int{}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			a := make(addedLines)
+			if err := a.parseDiff(dir, c.diff); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string][]int)
+			for file, lines := range a {
+				for line := range lines {
+					rel, _ := filepath.Rel(dir, file)
+					got[rel] = append(got[rel], line)
+				}
+			}
+			for _, lines := range got {
+				sort.Ints(lines)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got added lines %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAnyAddedHeader(t *testing.T) {
+	abs, err := filepath.Abs("bank.ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := addedLines{abs: {3: true}}
+	tx := &Tx{HeaderLine: 3}
+	tx.File, tx.Line = "bank.ledger", 4
+	if !a.anyAdded([]*Tx{tx}) {
+		t.Error("a posting whose transaction header was added is not added")
+	}
+	tx.HeaderLine = 2
+	if a.anyAdded([]*Tx{tx}) {
+		t.Error("a posting of an unchanged transaction is added")
+	}
+}
@@ -0,0 +1,263 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+)
+
+var spillThreshold = flag.Int64("spill-threshold", 1<<30, "size in `bytes` of XML inputs above which postings are sorted on disk rather than in memory, 0 for never")
+
+// spillRunSize is the number of postings sorted in memory before being
+// written to a temporary file
+var spillRunSize = 1 << 18
+
+// onDisk returns true if fileNames are all XML files and together larger
+// than threshold, to be searched with diskDuplicates
+func onDisk(fileNames []string, threshold int64) bool {
+	if threshold <= 0 {
+		return false
+	}
+	var size int64
+	for _, fileName := range fileNames {
+		f, err := os.Open(fileName)
+		if err != nil {
+			// Reported when reading it normally
+			return false
+		}
+		info, err := f.Stat()
+		start := make([]byte, 512)
+		n, _ := io.ReadFull(f, start)
+		f.Close()
+		if err != nil || !isXML(start[:n]) {
+			return false
+		}
+		size += info.Size()
+	}
+	return size > threshold
+}
+
+// isXML returns true if b starts, after spaces, with <
+func isXML(b []byte) bool {
+	for _, c := range b {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '<':
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// diskDuplicates returns the duplicates of the XML files fileNames like
+// findDuplicates, without holding all postings in memory: they are sorted by
+// amount in runs written to temporary files, which are then merged, one
+// amount at a time.
+func diskDuplicates(fileNames []string, match Matcher, window int, ignoredTag string) (duplicates [][]*Tx, err error) {
+	var runs []*os.File
+	defer func() {
+		for _, run := range runs {
+			run.Close()
+			os.Remove(run.Name())
+		}
+	}()
+
+	var postings []Tx
+	spill := func() error {
+		if len(postings) == 0 {
+			return nil
+		}
+		sort.SliceStable(postings, func(i, j int) bool {
+			return amountLess(&postings[i], &postings[j])
+		})
+		run, err := os.CreateTemp("", "ledger-lint-duplicate-*")
+		if err != nil {
+			return err
+		}
+		runs = append(runs, run)
+		w := bufio.NewWriter(run)
+		enc := gob.NewEncoder(w)
+		for i := range postings {
+			if err := enc.Encode(&postings[i]); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		postings = postings[:0]
+		_, err = run.Seek(0, io.SeekStart)
+		return err
+	}
+
+	for _, fileName := range fileNames {
+		err := readTransactions(fileName, func(tx Transaction, accounts map[string]string) error {
+			l := Ledger{}
+			l.Transactions.Transaction = []Transaction{tx}
+			txs, _ := l.toTxs(accounts)
+			for _, bucket := range txs {
+				for _, posting := range bucket {
+					if len(fileNames) > 1 {
+						posting.Input = fileName
+					}
+					postings = append(postings, posting)
+				}
+			}
+			if len(postings) >= spillRunSize {
+				return spill()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", fileName, err)
+		}
+	}
+	if err := spill(); err != nil {
+		return nil, err
+	}
+	slog.Debug("sorted postings on disk", "runs", len(runs))
+
+	h := make(runHeap, 0, len(runs))
+	for _, run := range runs {
+		r := &runReader{dec: gob.NewDecoder(bufio.NewReader(run))}
+		if err := r.next(); err != nil {
+			return nil, err
+		}
+		if r.ok {
+			h = append(h, r)
+		}
+	}
+	heap.Init(&h)
+
+	var bucket []Tx
+	for len(h) > 0 {
+		r := h[0]
+		if len(bucket) > 0 && r.tx.key() != bucket[0].key() {
+			duplicates = append(duplicates, bucketDuplicates(match, window, ignoredTag, bucket)...)
+			bucket = nil
+		}
+		bucket = append(bucket, r.tx)
+		if err := r.next(); err != nil {
+			return nil, err
+		}
+		if r.ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	duplicates = append(duplicates, bucketDuplicates(match, window, ignoredTag, bucket)...)
+	return dropReviewed(ignoredTag, duplicates), nil
+}
+
+// readTransactions calls f with each transaction of the XML file fileName,
+// decoded one by one, and the names of the accounts declared before it, by id
+func readTransactions(fileName string, f func(Transaction, map[string]string) error) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	dec := xml.NewDecoder(bufio.NewReader(file))
+	accounts := make(map[string]string)
+	for position := 0; ; {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if ok && start.Name.Local == "accounts" {
+			var l Ledger
+			if err := dec.DecodeElement(&l.Accounts, &start); err != nil {
+				return err
+			}
+			for id, name := range l.accountNames() {
+				accounts[id] = name
+			}
+			continue
+		}
+		if !ok || start.Name.Local != "transaction" {
+			continue
+		}
+		var tx Transaction
+		if err := dec.DecodeElement(&tx, &start); err != nil {
+			return err
+		}
+		tx.Offset = int(dec.InputOffset())
+		tx.Position = position
+		position++
+		if err := f(tx, accounts); err != nil {
+			return err
+		}
+	}
+}
+
+// A runReader reads the postings of a run, tx being the current one if ok
+type runReader struct {
+	dec *gob.Decoder
+	tx  Tx
+	ok  bool
+}
+
+func (r *runReader) next() error {
+	r.tx = Tx{}
+	err := r.dec.Decode(&r.tx)
+	r.ok = err == nil
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// amountLess orders postings by amount, those with the same key together
+func amountLess(a, b *Tx) bool {
+	if c := compareAmounts(a, b); c != 0 {
+		return c < 0
+	}
+	return a.key() < b.key()
+}
+
+// runHeap orders runs by the amount of their current posting
+type runHeap []*runReader
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return amountLess(&h[i].tx, &h[j].tx) }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
@@ -0,0 +1,210 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+var baselinePath = flag.String("assert-no-new", "", "fail if there are findings not in this baseline `file`, a state file from -state")
+var statePath = flag.String("state", "", "`file` keeping the state of findings between runs, to show and manage them with the state command")
+
+// States of findings
+const (
+	stateNew           = "new"
+	stateAcknowledged  = "acknowledged"
+	stateFixed         = "fixed"
+	stateFalsePositive = "false-positive"
+)
+
+// findingState is what the state file records of a finding
+type findingState struct {
+	State     string    `json:"state"`
+	Rule      string    `json:"rule"`
+	Title     string    `json:"title"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// findingStatus is the state of a finding as of a run, for reports
+type findingStatus struct {
+	State string `json:"state"`
+	// FirstSeen is a date, like 2024-11-02, Days ago
+	FirstSeen string `json:"first_seen"`
+	Days      int    `json:"days"`
+}
+
+// status returns the status of st as of now
+func (st *findingState) status(now time.Time) *findingStatus {
+	return &findingStatus{st.State, st.FirstSeen.Format("2006-01-02"), daysApart(st.FirstSeen, now)}
+}
+
+// age returns when st was first seen, like "2024-11-02, 47 days ago"
+func (st *findingStatus) age() string {
+	return fmt.Sprintf("%v, %v days ago", st.FirstSeen, st.Days)
+}
+
+// states are the recorded findings, by fingerprint
+type states map[string]*findingState
+
+// id returns the fingerprint of f, the same from one run to the next
+func (f *finding) id() string {
+	if f.txs != nil {
+		return fingerprint(f.txs...)
+	}
+	sum := sha256.Sum256([]byte(f.rule + "\x00" + f.file + "\x00" + f.message))
+	return hex.EncodeToString(sum[:6])
+}
+
+func loadStates(path string) (states, error) {
+	s := make(states)
+	b, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s states) save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(b, '\n'))
+}
+
+// update records findings, seen at now, and returns them with their status,
+// except false positives, and those first seen now.
+// Findings not seen anymore are fixed, and those seen again after being fixed
+// are new again.
+func (s states) update(findings []finding, now time.Time) (kept, fresh []finding) {
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		id := f.id()
+		seen[id] = true
+		st, exists := s[id]
+		if !exists || st.State == stateFixed {
+			st = &findingState{State: stateNew, Rule: f.rule, Title: f.title, FirstSeen: now}
+			s[id] = st
+			fresh = append(fresh, f)
+		}
+		st.LastSeen = now
+		if st.State == stateFalsePositive {
+			continue
+		}
+		f.status = st.status(now)
+		kept = append(kept, f)
+	}
+	for id, st := range s {
+		if !seen[id] && st.State != stateFalsePositive {
+			st.State = stateFixed
+		}
+	}
+	return kept, fresh
+}
+
+// stateCommand runs `state list` or `state set <state> <fingerprint>...` on
+// the state file at path
+func stateCommand(path string, args []string) error {
+	if path == "" {
+		return errors.New("no state file, set one with -state")
+	}
+	s, err := loadStates(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		ids := make([]string, 0, len(s))
+		for id := range s {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return s[ids[i]].FirstSeen.Before(s[ids[j]].FirstSeen)
+		})
+		for _, id := range ids {
+			st := s[id]
+			fmt.Printf("%v\t%v\t%v\t%v\n", id, st.State, st.status(time.Now()).age(), st.Title)
+		}
+		return nil
+	case len(args) >= 3 && args[0] == "set":
+		switch args[1] {
+		case stateNew, stateAcknowledged, stateFixed, stateFalsePositive:
+		default:
+			return fmt.Errorf("unknown state %q, expected %v, %v, %v or %v", args[1], stateNew, stateAcknowledged, stateFixed, stateFalsePositive)
+		}
+		for _, id := range args[2:] {
+			st, exists := s[id]
+			if !exists {
+				return fmt.Errorf("no finding %v in %v", id, path)
+			}
+			st.State = args[1]
+		}
+		return s.save(path)
+	}
+	return errors.New("usage: state list | state set <state> <fingerprint>...")
+}
+
+// notIn returns the findings not recorded in baseline, or recorded as fixed
+func notIn(baseline states, findings []finding) (added []finding) {
+	for _, f := range findings {
+		if st, exists := baseline[f.id()]; !exists || st.State == stateFixed {
+			added = append(added, f)
+		}
+	}
+	return added
+}
+
+// logAdded logs findings with, for each posting located in a journal, the
+// git commit that introduced it. They go to the logs rather than stdout, to
+// keep machine readable reports valid.
+func logAdded(baselinePath string, findings []finding) {
+	for _, f := range findings {
+		if f.txs == nil {
+			slog.Error("finding not in the baseline", "baseline", baselinePath, "title", f.title, "fingerprint", f.id(),
+				"at", fmt.Sprintf("%v:%v", f.file, f.line), "message", f.message)
+		}
+		for _, tx := range f.txs {
+			commit := "unknown commit"
+			if tx.File != "" {
+				if c, err := blame(tx.File, tx.Line); err == nil {
+					commit = c
+				}
+			}
+			slog.Error("finding not in the baseline", "baseline", baselinePath, "title", f.title, "fingerprint", f.id(),
+				"at", tx.where(""), "posting", tx.describe(), "commit", commit)
+		}
+	}
+}
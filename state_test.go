@@ -0,0 +1,134 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatesUpdate(t *testing.T) {
+	findings := map[string]finding{
+		"a": {rule: "policy", title: "A", message: "a"},
+		"b": {rule: "policy", title: "B", message: "b"},
+	}
+	id := func(name string) string {
+		f := findings[name]
+		return f.id()
+	}
+	s := make(states)
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 22, 0, 0, 0, time.UTC) }
+	// Runs in order, each after setting the states of set, if any
+	for _, run := range []struct {
+		name  string
+		set   map[string]string
+		found []string
+		day   int
+		// Findings kept, fresh, and the states of all
+		kept, fresh []string
+		states      map[string]string
+		days        int
+	}{
+		{"first seen", nil, []string{"a", "b"}, 1, []string{"a", "b"}, []string{"a", "b"}, map[string]string{"a": stateNew, "b": stateNew}, 0},
+		{"seen again", nil, []string{"a", "b"}, 2, []string{"a", "b"}, nil, map[string]string{"a": stateNew, "b": stateNew}, 1},
+		{"acknowledged", map[string]string{"a": stateAcknowledged}, []string{"a", "b"}, 3, []string{"a", "b"}, nil, map[string]string{"a": stateAcknowledged, "b": stateNew}, 2},
+		{"false positive", map[string]string{"b": stateFalsePositive}, []string{"a", "b"}, 4, []string{"a"}, nil, map[string]string{"a": stateAcknowledged, "b": stateFalsePositive}, 3},
+		{"not seen anymore", nil, nil, 5, nil, nil, map[string]string{"a": stateFixed, "b": stateFalsePositive}, 0},
+		{"seen again once fixed", nil, []string{"a", "b"}, 6, []string{"a"}, []string{"a"}, map[string]string{"a": stateNew, "b": stateFalsePositive}, 0},
+	} {
+		for name, state := range run.set {
+			s[id(name)].State = state
+		}
+		var found []finding
+		for _, name := range run.found {
+			found = append(found, findings[name])
+		}
+		kept, fresh := s.update(found, day(run.day))
+		names := func(fs []finding) (names []string) {
+			for _, f := range fs {
+				names = append(names, f.message)
+			}
+			return names
+		}
+		if got := names(kept); !reflect.DeepEqual(got, run.kept) {
+			t.Errorf("%v: got findings %v, want %v", run.name, got, run.kept)
+		}
+		if got := names(fresh); !reflect.DeepEqual(got, run.fresh) {
+			t.Errorf("%v: got new findings %v, want %v", run.name, got, run.fresh)
+		}
+		for name, want := range run.states {
+			if got := s[id(name)].State; got != want {
+				t.Errorf("%v: %v is %v, want %v", run.name, name, got, want)
+			}
+		}
+		for _, f := range kept {
+			if f.status == nil || f.status.State != run.states[f.message] || f.status.Days != run.days {
+				t.Errorf("%v: got status %+v of %v, want %v %v days ago", run.name, f.status, f.message, run.states[f.message], run.days)
+			}
+		}
+	}
+
+	// States are kept between runs
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := s.save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadStates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, s) {
+		t.Errorf("loaded %v, saved %v", loaded, s)
+	}
+}
+
+func TestStateCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	f := finding{rule: "policy", title: "A", message: "a"}
+	s := make(states)
+	s.update([]finding{f}, time.Now())
+	if err := s.save(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		args  []string
+		state string
+		fails bool
+	}{
+		{[]string{"set", stateAcknowledged, f.id()}, stateAcknowledged, false},
+		{[]string{"set", "done", f.id()}, stateAcknowledged, true},
+		{[]string{"set", stateFixed, "unknown"}, stateAcknowledged, true},
+		{[]string{"set", stateFalsePositive}, stateAcknowledged, true},
+		{[]string{"set", stateFalsePositive, f.id()}, stateFalsePositive, false},
+	} {
+		err := stateCommand(path, c.args)
+		if (err != nil) != c.fails {
+			t.Errorf("state %v: got error %v", c.args, err)
+		}
+		loaded, err := loadStates(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := loaded[f.id()].State; got != c.state {
+			t.Errorf("state %v: got %v, want %v", c.args, got, c.state)
+		}
+	}
+}
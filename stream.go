@@ -0,0 +1,324 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+var indexPath = flag.String("write-index", "", "write the postings of the ledger to this `file`, as an index for importers using the dedupe package")
+
+// Candidate is a transaction streamed in by an importer, one JSON object per
+// line, to be checked against the ledger. An empty Account matches any account,
+// and an empty Commodity any commodity. Amount is a decimal, as a JSON number
+// or string. Workspace selects the ledger to check against, the default one if
+// empty.
+type Candidate struct {
+	Workspace string      `json:"workspace,omitempty"`
+	Date      string      `json:"date"`
+	Payee     string      `json:"payee"`
+	Account   string      `json:"account"`
+	Amount    json.Number `json:"amount"`
+	Commodity string      `json:"commodity,omitempty"`
+}
+
+// Verdict is the answer written back for each Candidate. Version is
+// schemaVersion.
+type Verdict struct {
+	Version   int    `json:"version"`
+	Duplicate bool   `json:"duplicate"`
+	Matches   []*Tx  `json:"matches,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// indexSettings are the settings of the scan that an Index follows, for
+// candidates to be duplicates of the postings the scan would group them with
+type indexSettings struct {
+	maxDays   int
+	match     Matcher
+	tolerance tolerance
+	// ignoredTag leaves postings out, like the ignore tag of the scan, and
+	// ignored and rules are the fingerprints and rules of the ignore file
+	ignoredTag string
+	ignored    map[string]bool
+	rules      []ignoreRule
+}
+
+// scanSettings returns the indexSettings of the flags, for postings at most
+// days days apart with s the -script, if not nil
+func scanSettings(days float64, s *script) (indexSettings, error) {
+	maxDays := windowDays(days)
+	match, err := scanMatcher(maxDays, s)
+	if err != nil {
+		return indexSettings{}, err
+	}
+	if amountTolerance.enabled() {
+		match = allOf(match, amountWithin(amountTolerance))
+	}
+	ignored, rules, err := loadIgnored(*ignoreFile)
+	if err != nil {
+		return indexSettings{}, err
+	}
+	return indexSettings{maxDays, match, amountTolerance, *ignoredTag, ignored, rules}, nil
+}
+
+// Index answers whether a transaction duplicates one already in the ledger.
+// It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	settings indexSettings
+	// postings are sorted by amount, whatever their commodity, candidates
+	// matching any commodity, then by date
+	postings []indexedTx
+}
+
+// An indexedTx is a posting of an Index with its exact amount
+type indexedTx struct {
+	tx     Tx
+	amount *big.Rat
+}
+
+// newIndex builds an Index from txs, as returned by toTxs, checking
+// candidates with settings
+func newIndex(settings indexSettings, txs map[amountKey][]Tx) *Index {
+	idx := &Index{}
+	idx.reset(settings, txs)
+	return idx
+}
+
+// reset replaces the content of the index, as newIndex would build it
+func (idx *Index) reset(settings indexSettings, txs map[amountKey][]Tx) {
+	var postings []indexedTx
+	for _, k := range sortedKeys(txs) {
+		for _, tx := range txs[k] {
+			postings = append(postings, indexedTx{tx, tx.exact()})
+		}
+	}
+	sort.SliceStable(postings, func(i, j int) bool {
+		if c := postings[i].amount.Cmp(postings[j].amount); c != 0 {
+			return c < 0
+		}
+		return postings[i].tx.Date.Before(postings[j].tx.Date)
+	})
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.settings, idx.postings = settings, postings
+}
+
+// replace replaces the content of the index with that of other, a new index
+func (idx *Index) replace(other *Index) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.settings, idx.postings = other.settings, other.postings
+}
+
+// check returns the transactions of the index that c may duplicate
+func (idx *Index) check(c Candidate) Verdict {
+	date, err := time.Parse("2006-01-02", c.Date)
+	if err != nil {
+		return Verdict{Error: err.Error()}
+	}
+	amount, err := parseNumber(c.Amount.String())
+	if err != nil {
+		return Verdict{Error: err.Error()}
+	}
+	candidate := Tx{Tx: dedupe.Tx{Date: date, Payee: c.Payee, Account: c.Account, Commodity: c.Commodity}}
+	candidate.setQuantity(amount)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	settings := &idx.settings
+	var v Verdict
+	if _, ignored := ignoredBy(settings.rules, &candidate); ignored {
+		return v
+	}
+	low, high := settings.tolerance.bounds(amount)
+	start := sort.Search(len(idx.postings), func(i int) bool {
+		return idx.postings[i].amount.Cmp(low) >= 0
+	})
+	for i := start; i < len(idx.postings) && idx.postings[i].amount.Cmp(high) <= 0; i++ {
+		tx := &idx.postings[i].tx
+		if c.Account != "" && c.Account != tx.Account {
+			continue
+		}
+		if c.Commodity != "" && c.Commodity != tx.Commodity {
+			continue
+		}
+		candidate.Commodity = tx.Commodity
+		if _, ignored := ignoredBy(settings.rules, tx); ignored || find(settings.ignoredTag, tx.PostingTags) {
+			continue
+		}
+		if daysApart(tx.Date, date) <= settings.maxDays && settings.match(&candidate, tx) && !settings.ignored[fingerprint(&candidate, tx)] {
+			v.Matches = append(v.Matches, tx)
+		}
+	}
+	v.Duplicate = len(v.Matches) > 0
+	return v
+}
+
+// writeIndex writes txs to fileName as a dedupe.Index, for candidates at most
+// maxDays days apart from them to be duplicates
+func writeIndex(fileName string, maxDays int, txs map[amountKey][]Tx) error {
+	var postings []dedupe.Tx
+	for _, bucket := range txs {
+		for _, tx := range bucket {
+			postings = append(postings, dedupe.Tx{
+				Date:      tx.Date,
+				Payee:     tx.Payee,
+				Account:   tx.Account,
+				Amount:    tx.Amount,
+				Commodity: tx.Commodity,
+				File:      tx.File,
+				Line:      tx.Line,
+			})
+		}
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := dedupe.NewIndex(time.Duration(maxDays)*24*time.Hour, postings).WriteTo(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Workspaces are the indexes served, by name, "" being the default one
+type Workspaces map[string]*Index
+
+func (ws Workspaces) check(c Candidate) Verdict {
+	idx, exists := ws[c.Workspace]
+	if !exists {
+		return Verdict{Error: fmt.Sprintf("unknown workspace %q", c.Workspace)}
+	}
+	return idx.check(c)
+}
+
+// serve reads candidates from r, one per line, and writes a verdict line for
+// each to w as soon as it is read.
+func (ws Workspaces) serve(r io.Reader, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var c Candidate
+		var v Verdict
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			v = Verdict{Error: err.Error()}
+		} else {
+			v = ws.check(c)
+		}
+		v.Version = schemaVersion
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// stream serves candidates from path until it is closed. path is a file or a
+// named pipe, with verdicts written to stdout, "unix:" followed by the path
+// of a socket to listen on, answering each connection on itself, "http:"
+// followed by an address to serve HTTP on (see httpServer), or "queue:"
+// followed by a directory of candidate files (see queue).
+func (ws Workspaces) stream(path string) error {
+	if dir, ok := strings.CutPrefix(path, "queue:"); ok {
+		return ws.queue(dir)
+	}
+	if addr, ok := strings.CutPrefix(path, "http:"); ok {
+		s := &httpServer{ws: ws}
+		// Reloads can change the flags meanwhile
+		settingsMu.RLock()
+		s.tokens = splitTokens(*streamTokens)
+		if host, _, _ := net.SplitHostPort(addr); len(s.tokens) == 0 && (host == "" || !net.ParseIP(host).IsLoopback() && host != "localhost") {
+			slog.Warn("serving on the network without -stream-tokens, anybody reaching it can query the ledger", "addr", addr)
+		}
+		if *streamRateLimit > 0 {
+			s.limiter = newRateLimiter(*streamRateLimit)
+		}
+		settingsMu.RUnlock()
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           s,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       time.Minute,
+		}
+		return server.ListenAndServe()
+	}
+
+	if strings.HasPrefix(path, "unix:") {
+		l, err := net.Listen("unix", strings.TrimPrefix(path, "unix:"))
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return err
+			}
+			go func() {
+				defer conn.Close()
+				if err := ws.serve(conn, conn); err != nil {
+					slog.Error("serving connection failed", "err", err)
+				}
+			}()
+		}
+	}
+
+	// Opening a named pipe blocks until a writer shows up, and every writer
+	// closing gives EOF, so reopen to keep serving successive importers.
+	for {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = ws.serve(f, os.Stdout)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeNamedPipe == 0 {
+			return nil
+		}
+	}
+}
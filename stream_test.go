@@ -0,0 +1,140 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+func TestIndexCheck(t *testing.T) {
+	txs, err := parseJournal("main.ledger", []byte(`2024/03/01 Coffee Shop
+    Expenses:Food  10.10 EUR
+    Assets:Bank
+
+2024/03/05 Bakery
+    Expenses:Food  3 USD
+    ; :notDup:
+    Assets:Bank
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fuzzy, err := newMatcher("fuzzy-payee", dedupe.MatchOptions{MaxDays: 5, PayeeSimilarity: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tol tolerance
+	if err := tol.Set("0.5"); err != nil {
+		t.Fatal(err)
+	}
+	settings := indexSettings{maxDays: 5, match: fuzzy, ignoredTag: "notDup", ignored: map[string]bool{}}
+	for _, c := range []struct {
+		name      string
+		tolerance bool
+		candidate Candidate
+		want      []string
+		err       string
+	}{
+		{"duplicate", false, Candidate{Date: "2024-03-02", Payee: "COFFEE SHOP", Account: "Expenses:Food", Amount: "10.10", Commodity: "EUR"}, []string{"main.ledger:2"}, ""},
+		{"any account and commodity", false, Candidate{Date: "2024-03-02", Payee: "Coffee shop", Amount: "-10.1"}, []string{"main.ledger:3"}, ""},
+		{"other account", false, Candidate{Date: "2024-03-02", Payee: "Coffee shop", Account: "Expenses:Rent", Amount: "10.1"}, nil, ""},
+		{"other commodity", false, Candidate{Date: "2024-03-02", Payee: "Coffee shop", Amount: "10.1", Commodity: "USD"}, nil, ""},
+		{"other payee", false, Candidate{Date: "2024-03-02", Payee: "Rent", Amount: "10.1"}, nil, ""},
+		{"too late", false, Candidate{Date: "2024-03-07", Payee: "Coffee shop", Amount: "10.1"}, nil, ""},
+		{"amount differs", false, Candidate{Date: "2024-03-02", Payee: "Coffee shop", Amount: "10.2"}, nil, ""},
+		{"within the tolerance", true, Candidate{Date: "2024-03-02", Payee: "Coffee shop", Amount: "10.5"}, []string{"main.ledger:2"}, ""},
+		{"ignored tag", false, Candidate{Date: "2024-03-05", Payee: "Bakery", Account: "Expenses:Food", Amount: "3"}, nil, ""},
+		{"invalid amount", false, Candidate{Date: "2024-03-02", Payee: "Coffee shop", Amount: "0x10"}, nil, "invalid number"},
+		{"invalid date", false, Candidate{Date: "02/03/2024", Payee: "Coffee shop", Amount: "10.1"}, nil, "cannot parse"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			s := settings
+			if c.tolerance {
+				s.tolerance = tol
+				s.match = allOf(fuzzy, amountWithin(tol))
+			}
+			v := newIndex(s, txs).check(c.candidate)
+			if c.err != "" {
+				if !strings.Contains(v.Error, c.err) {
+					t.Errorf("got error %q, want %q", v.Error, c.err)
+				}
+				return
+			}
+			var got []string
+			for _, tx := range v.Matches {
+				got = append(got, tx.position())
+			}
+			if strings.Join(got, " ") != strings.Join(c.want, " ") || v.Duplicate != (len(c.want) > 0) {
+				t.Errorf("got matches %v, duplicate %v, want %v", got, v.Duplicate, c.want)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	txs, err := parseJournal("main.ledger", []byte(`2024/03/01 Shop
+    Expenses:Food  10 EUR
+    Assets:Bank
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anything := func(a, b *Tx) bool { return true }
+	ws := Workspaces{"": newIndex(indexSettings{maxDays: 5, match: anything}, txs)}
+	in := `{"date": "2024-03-02", "payee": "Shop", "account": "Expenses:Food", "amount": 10}
+
+{"date": "2024-03-02", "payee": "Shop", "amount": "11"}
+not json
+{"workspace": "other", "date": "2024-03-02", "amount": 10}
+`
+	var out strings.Builder
+	if err := ws.serve(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	var verdicts []Verdict
+	dec := json.NewDecoder(strings.NewReader(out.String()))
+	for dec.More() {
+		var v Verdict
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		verdicts = append(verdicts, v)
+	}
+	if len(verdicts) != 4 {
+		t.Fatalf("got %v verdicts, want one for each of the 4 candidates:\n%v", len(verdicts), out.String())
+	}
+	for i, want := range []struct {
+		duplicate bool
+		err       string
+	}{
+		{true, ""},
+		{false, ""},
+		{false, "invalid character"},
+		{false, `unknown workspace "other"`},
+	} {
+		v := verdicts[i]
+		if v.Version != schemaVersion || v.Duplicate != want.duplicate || !strings.Contains(v.Error, want.err) || (want.err == "") != (v.Error == "") {
+			t.Errorf("verdict %v: got %+v, want duplicate %v and error %q", i, v, want.duplicate, want.err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var strict = flag.Bool("strict", false, "report postings to accounts or in commodities not declared with account or commodity directives in the journals given, and exit with status 1 if there are any, like ledger --strict")
+
+// journalDeclarations returns the accounts and commodities declared in the
+// journal b with account and commodity directives
+func journalDeclarations(b []byte) (accounts, commodities []string) {
+	for _, line := range strings.Split(string(b), "\n") {
+		keyword, rest, _ := strings.Cut(line, " ")
+		// Without a trailing comment
+		if i := strings.Index(rest, "  ;"); i >= 0 {
+			rest = rest[:i]
+		}
+		rest = strings.TrimSpace(rest)
+		switch keyword {
+		case "account":
+			accounts = append(accounts, rest)
+		case "commodity":
+			// Like "commodity 1,000.00 EUR", with a sample amount
+			if _, symbol, withAmount := strings.Cut(rest, " "); withAmount && strings.ContainsAny(rest, "0123456789") {
+				rest = strings.Trim(strings.TrimSpace(symbol), `"`)
+			}
+			commodities = append(commodities, strings.Trim(rest, `"`))
+		}
+	}
+	return accounts, commodities
+}
+
+// checkDeclared returns the postings to accounts not among accounts and in
+// commodities not among commodities, grouped by account or commodity
+func checkDeclared(accounts, commodities []string, ignoredTag string, txs []*Tx) (violations []finding) {
+	declared := make(map[string]bool)
+	for _, a := range accounts {
+		declared["account "+a] = true
+	}
+	for _, c := range commodities {
+		declared["commodity "+c] = true
+	}
+	index := make(map[string]int)
+	add := func(key, title string, tx *Tx) {
+		i, exists := index[key]
+		if !exists {
+			i = len(violations)
+			index[key] = i
+			violations = append(violations, finding{rule: "undeclared", title: title})
+		}
+		violations[i].txs = append(violations[i].txs, tx)
+	}
+	for _, tx := range txs {
+		if tx.hasTag(ignoredTag) {
+			continue
+		}
+		if !declared["account "+tx.Account] {
+			add("account "+tx.Account, fmt.Sprintf("Undeclared account %v", tx.Account), tx)
+		}
+		if tx.Commodity != "" && !declared["commodity "+tx.Commodity] {
+			add("commodity "+tx.Commodity, fmt.Sprintf("Undeclared commodity %q", tx.Commodity), tx)
+		}
+	}
+	return violations
+}
@@ -0,0 +1,86 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var subscriptionTag = flag.String("subscription-tag", "subscription", "payees with a transaction with this tag are subscriptions, charged at most once a month")
+var subscriptionPayees = flag.String("subscriptions", "", "comma-separated list of subscription payees, charged at most once a month")
+
+// findSubscriptionDuplicates returns, for each payee that is a subscription,
+// the charges (positive postings) to the same account within the same month,
+// when there are several of them. Payees are subscriptions when they are in
+// payees or when one of their transactions has tag.
+func findSubscriptionDuplicates(tag string, payees []string, ignoredTag string, txs []*Tx) (duplicates [][]*Tx) {
+	subscriptions := make(map[string]bool)
+	for _, p := range payees {
+		subscriptions[p] = true
+	}
+	for _, tx := range txs {
+		if tag != "" && find(tag, tx.Tags) {
+			subscriptions[tx.Payee] = true
+		}
+	}
+
+	type key struct {
+		payee, account string
+		year           int
+		month          int
+	}
+	var keys []key
+	charges := make(map[key][]*Tx)
+	for _, tx := range txs {
+		if !subscriptions[tx.Payee] || tx.Amount <= 0 || find(ignoredTag, tx.PostingTags) {
+			continue
+		}
+		k := key{tx.Payee, tx.Account, tx.Date.Year(), int(tx.Date.Month())}
+		if _, exists := charges[k]; !exists {
+			keys = append(keys, k)
+		}
+		charges[k] = append(charges[k], tx)
+	}
+
+	for _, k := range keys {
+		group := charges[k]
+		if len(group) <= 1 {
+			continue
+		}
+		// If all charges have the ignore tag, drop them
+		for _, tx := range group {
+			if !find(ignoredTag, tx.Tags) {
+				duplicates = append(duplicates, group)
+				break
+			}
+		}
+	}
+	return duplicates
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(s string) (items []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,252 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+// timeEntry is a time-tracking entry, with its duration in hours as the
+// amount. Start and End are only known for timeclock sessions.
+type timeEntry struct {
+	Tx
+	Start, End time.Time
+}
+
+// isTimeFile returns true for hledger timeclock and timedot files, which are
+// recognised by their extension
+func isTimeFile(fileName string) bool {
+	ext := filepath.Ext(fileName)
+	return ext == ".timeclock" || ext == ".timedot"
+}
+
+func parseTimeFile(fileName string, b []byte) ([]timeEntry, error) {
+	if filepath.Ext(fileName) == ".timedot" {
+		return parseTimedot(fileName, b)
+	}
+	return parseTimeclock(fileName, b)
+}
+
+func parseTimeDate(s string) (time.Time, error) {
+	return time.Parse("2006-1-2", strings.ReplaceAll(s, "/", "-"))
+}
+
+// parseTimeclock reads lines like
+//
+//	i 2015/03/30 09:00:00 some:account  description
+//	o 2015/03/30 10:20:00
+func parseTimeclock(fileName string, b []byte) (entries []timeEntry, err error) {
+	var clockIn *timeEntry
+	var directives accountDirectives
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		if directives.read(fileName, line, scanner.Text()) {
+			continue
+		}
+		m := timeclockLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		code := strings.ToLower(m[1])
+		at, err := time.Parse("2006-1-2 15:04:05", strings.ReplaceAll(m[2], "/", "-")+" "+withSeconds(m[3]))
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", fileName, line, err)
+		}
+
+		switch code {
+		case "i":
+			if clockIn != nil {
+				return nil, fmt.Errorf("%v:%v: clock-in without clock-out since line %v", fileName, line, clockIn.Line)
+			}
+			var description string
+			account := strings.TrimSpace(m[4])
+			if i := strings.Index(account, "  "); i >= 0 {
+				account, description = account[:i], strings.TrimSpace(account[i:])
+			}
+			y, m, d := at.Date()
+			clockIn = &timeEntry{
+				Tx: Tx{
+					Tx: dedupe.Tx{
+						Date:    time.Date(y, m, d, 0, 0, 0, 0, time.UTC),
+						File:    fileName,
+						Line:    line,
+						Payee:   description,
+						Account: directives.expand(account),
+					},
+					Position: len(entries),
+				},
+				Start: at,
+			}
+		case "o":
+			if clockIn == nil {
+				return nil, fmt.Errorf("%v:%v: clock-out without clock-in", fileName, line)
+			}
+			if at.Before(clockIn.Start) {
+				return nil, fmt.Errorf("%v:%v: clock-out before clock-in", fileName, line)
+			}
+			clockIn.End = at
+			clockIn.Amount = at.Sub(clockIn.Start).Hours()
+			entries = append(entries, *clockIn)
+			clockIn = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if clockIn != nil {
+		return nil, fmt.Errorf("%v:%v: clock-in without clock-out", fileName, clockIn.Line)
+	}
+	return entries, nil
+}
+
+var timeclockLine = regexp.MustCompile(`^([iIoO])\s+(\S+)\s+(\S+)\s*(.*)$`)
+
+func withSeconds(t string) string {
+	if strings.Count(t, ":") == 1 {
+		return t + ":00"
+	}
+	return t
+}
+
+// parseTimedot reads a date line followed by lines of account and quantity,
+// where a quantity is either dots (a quarter hour each) or a number of hours,
+// optionally suffixed with a unit (s, m, h, d), and then maybe a ; comment
+func parseTimedot(fileName string, b []byte) (entries []timeEntry, err error) {
+	var date time.Time
+	var directives accountDirectives
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, ";"); i >= 0 {
+			// A trailing comment
+			text = text[:i]
+		}
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.ContainsAny(trimmed[:1], "#;*") || directives.read(fileName, line, text) {
+			continue
+		}
+		fields := strings.Fields(trimmed)
+		if d, err := parseTimeDate(fields[0]); err == nil && text[0] != ' ' && text[0] != '\t' {
+			date = d
+			continue
+		}
+		if date.IsZero() {
+			return nil, fmt.Errorf("%v:%v: entry before any date", fileName, line)
+		}
+
+		hours, err := timedotQuantity(strings.Join(fields[1:], ""))
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", fileName, line, err)
+		}
+		entries = append(entries, timeEntry{Tx: Tx{
+			Tx: dedupe.Tx{
+				Date:    date,
+				File:    fileName,
+				Line:    line,
+				Account: directives.expand(fields[0]),
+				Amount:  hours,
+			},
+			Position: len(entries),
+		}})
+	}
+	return entries, scanner.Err()
+}
+
+func timedotQuantity(q string) (float64, error) {
+	if q == "" || strings.Trim(q, ".") == "" {
+		return float64(len(q)) / 4, nil
+	}
+	units := map[byte]float64{'s': 1. / 3600, 'm': 1. / 60, 'h': 1, 'd': 24}
+	factor := 1.
+	if f, ok := units[q[len(q)-1]]; ok {
+		factor = f
+		q = q[:len(q)-1]
+	}
+	n, err := strconv.ParseFloat(q, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", q)
+	}
+	return n * factor, nil
+}
+
+// findTimeDuplicates returns groups of entries on the same day, for the same
+// account and with identical durations, followed by groups of timeclock
+// sessions overlapping each other
+func findTimeDuplicates(entries []timeEntry) (duplicates, overlaps [][]*Tx) {
+	type key struct {
+		date     time.Time
+		account  string
+		duration float64
+	}
+	groups := make(map[key][]*Tx)
+	var keys []key
+	for i := range entries {
+		e := &entries[i]
+		k := key{e.Date, e.Account, e.Amount}
+		if _, exists := groups[k]; !exists {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], &e.Tx)
+	}
+	for _, k := range keys {
+		if len(groups[k]) > 1 {
+			duplicates = append(duplicates, groups[k])
+		}
+	}
+
+	var sessions []*timeEntry
+	for i := range entries {
+		if !entries[i].Start.IsZero() {
+			sessions = append(sessions, &entries[i])
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+	var group []*Tx
+	var groupEnd time.Time
+	for _, s := range sessions {
+		if len(group) > 0 && s.Start.Before(groupEnd) {
+			group = append(group, &s.Tx)
+		} else {
+			if len(group) > 1 {
+				overlaps = append(overlaps, group)
+			}
+			group = []*Tx{&s.Tx}
+			groupEnd = s.End
+		}
+		if s.End.After(groupEnd) {
+			groupEnd = s.End
+		}
+	}
+	if len(group) > 1 {
+		overlaps = append(overlaps, group)
+	}
+	return duplicates, overlaps
+}
@@ -0,0 +1,79 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTimeFile(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		fileName string
+		content  string
+		want     []float64
+		err      string
+	}{
+		{"timeclock", "work.timeclock", `i 2024/03/01 09:00:00 client:a  meeting
+o 2024/03/01 10:30:00
+i 2024/03/01 11:00 client:b
+o 2024/03/01 11:15
+`, []float64{1.5, 0.25}, ""},
+		{"timeclock left open", "work.timeclock", `i 2024/03/01 09:00:00 client:a
+o 2024/03/01 10:00:00
+i 2024/03/01 11:00:00 client:b
+`, nil, "work.timeclock:3: clock-in without clock-out"},
+		{"clock-out without clock-in", "work.timeclock", `o 2024/03/01 10:00:00
+`, nil, "work.timeclock:1: clock-out without clock-in"},
+		{"timedot", "work.timedot", `2024-03-01
+client:a  ....
+client:b  1.5h
+client:c  30m
+`, []float64{1, 1.5, 0.5}, ""},
+		{"timedot comments", "work.timedot", `# week 9
+2024-03-01  ; friday
+client:a  .... ..  ; standup included
+client:b  2  ; hours
+`, []float64{1.5, 2}, ""},
+		{"timedot before a date", "work.timedot", `client:a  ....
+`, nil, "work.timedot:1: entry before any date"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			entries, err := parseTimeFile(c.fileName, []byte(c.content))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(c.want) {
+				t.Fatalf("got %v entries, want %v", len(entries), len(c.want))
+			}
+			for i, e := range entries {
+				if e.Amount != c.want[i] {
+					t.Errorf("entry %v: got %v hours, want %v", i, e.Amount, c.want[i])
+				}
+			}
+		})
+	}
+}
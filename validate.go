@@ -0,0 +1,168 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validationTx mirrors the parts of Transaction that are needed for the
+// duplicate search, with pointers to tell missing elements apart
+type validationTx struct {
+	Date     *string `xml:"date"`
+	Payee    *string `xml:"payee"`
+	Postings *struct {
+		Posting []struct {
+			Account *struct {
+				Ref  string  `xml:"ref,attr"`
+				Name *string `xml:"name"`
+			} `xml:"account"`
+			Quantity *string `xml:"post-amount>amount>quantity"`
+		} `xml:"posting"`
+	} `xml:"postings"`
+}
+
+// ledgerVersion decodes the version attribute of ledger's XML, which packs
+// major, minor and patch versions in one integer
+func ledgerVersion(attr string) (major, minor, patch int, err error) {
+	v, err := strconv.Atoi(attr)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid version attribute %q", attr)
+	}
+	return v >> 16, (v >> 8) & 0xff, v & 0xff, nil
+}
+
+// validate checks that b, the output of `ledger xml`, has the structure the
+// duplicate search expects, returning the problems found
+func validate(b []byte) (problems []string) {
+	var root struct {
+		XMLName xml.Name
+		Version string `xml:"version,attr"`
+		Entries []struct {
+		} `xml:"entry"`
+		Accounts struct {
+			Account []xmlAccount `xml:"account"`
+		} `xml:"accounts"`
+		Transactions *struct {
+		} `xml:"transactions"`
+	}
+	if err := xml.Unmarshal(b, &root); err != nil {
+		return []string{err.Error()}
+	}
+	if root.XMLName.Local != "ledger" {
+		return []string{fmt.Sprintf("root element is <%v>, not <ledger>", root.XMLName.Local)}
+	}
+
+	if len(root.Entries) > 0 {
+		return []string{fmt.Sprintf("ledger %v format (with <entry> elements) is not supported, use ledger 3", root.Version)}
+	}
+
+	major, minor, patch, err := ledgerVersion(root.Version)
+	switch {
+	case root.Version == "":
+		problems = append(problems, "no version attribute on <ledger>")
+	case err != nil:
+		problems = append(problems, err.Error())
+	case major != 3 || minor < 1 || minor > 3:
+		problems = append(problems, fmt.Sprintf("ledger %v.%v.%v has not been tested, only 3.1 to 3.3 are", major, minor, patch))
+	}
+	if root.Transactions == nil {
+		return append(problems, "no <transactions> element")
+	}
+
+	var l Ledger
+	l.Accounts.Account = root.Accounts.Account
+	accounts := l.accountNames()
+
+	endTag := []byte("</transaction>")
+	for start := nextTransaction(b, 0); start >= 0; start = nextTransaction(b, start+1) {
+		at := func(format string, a ...interface{}) {
+			problems = append(problems, fmt.Sprintf("transaction at offset %v: ", start)+fmt.Sprintf(format, a...))
+		}
+		end := bytes.Index(b[start:], endTag)
+		if end < 0 {
+			at("unterminated")
+			break
+		}
+		var tx validationTx
+		if err := xml.Unmarshal(b[start:start+end+len(endTag)], &tx); err != nil {
+			at("%v", err)
+			continue
+		}
+
+		if tx.Date == nil {
+			at("no <date>")
+		} else if _, err := time.Parse("2006/01/02", *tx.Date); err != nil {
+			at("invalid date: %v", err)
+		}
+		if tx.Payee == nil {
+			at("no <payee>")
+		}
+		if tx.Postings == nil || len(tx.Postings.Posting) == 0 {
+			at("no <posting>")
+			continue
+		}
+		for i, p := range tx.Postings.Posting {
+			if p.Account == nil {
+				at("posting %v: no <account>", i)
+			} else if (p.Account.Name == nil || strings.TrimSpace(*p.Account.Name) == "") && accounts[p.Account.Ref] == "" {
+				at("posting %v: account without <name>, nor a ref to <accounts>", i)
+			}
+			if p.Quantity == nil {
+				at("posting %v: no <post-amount><amount><quantity>", i)
+			} else if _, err := parseNumber(strings.TrimSpace(*p.Quantity)); err != nil {
+				at("posting %v: invalid quantity %q", i, *p.Quantity)
+			}
+		}
+	}
+	return problems
+}
+
+// validateFiles runs validate on each file, exporting journals to XML first,
+// and prints the problems found. It returns false if there were any.
+func validateFiles(ledgerArgs string, fileNames ...string) (ok bool) {
+	ok = true
+	for _, fileName := range fileNames {
+		b, err := readInput(fileName)
+		if err == nil && !strings.HasPrefix(strings.TrimSpace(string(b)), "<") {
+			b, err = exportXML(fileName, ledgerArgs)
+		}
+		if err != nil {
+			fmt.Printf("%v: %v\n", fileName, err)
+			ok = false
+			continue
+		}
+
+		problems := validate(b)
+		for _, p := range problems {
+			fmt.Printf("%v: %v\n", fileName, p)
+		}
+		if len(problems) > 0 {
+			ok = false
+		} else {
+			fmt.Printf("%v: ok\n", fileName)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,56 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateQuantity(t *testing.T) {
+	for _, c := range []struct {
+		quantity string
+		valid    bool
+	}{
+		{"10", true},
+		{"-10.50", true},
+		{"1e3", true},
+		{"NaN", false},
+		{"Inf", false},
+		{"0x10", false},
+		{"1/3", false},
+		{"ten", false},
+	} {
+		t.Run(c.quantity, func(t *testing.T) {
+			xml := fmt.Sprintf(`<ledger version="196864"><transactions><transaction>
+<date>2021/01/01</date><payee>Shop</payee><postings><posting>
+<account><name>Expenses:Food</name></account>
+<post-amount><amount><quantity>%v</quantity></amount></post-amount>
+</posting></postings></transaction></transactions></ledger>`, c.quantity)
+			problems := validate([]byte(xml))
+			if c.valid && len(problems) > 0 {
+				t.Errorf("got problems %v for a valid quantity", problems)
+			}
+			if !c.valid && (len(problems) != 1 || !strings.Contains(problems[0], "invalid quantity")) {
+				t.Errorf("got problems %v, want an invalid quantity", problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"joly.pw/ledger-lint-duplicate/dedupe"
+)
+
+var weightsPath = flag.String("weights", "", "score candidate pairs with the linear model and rules of this `file`, instead of -matchers")
+
+// pairFeatureNames are the names of the features of pairs of postings, as
+// columns of -export-pairs and in -weights files
+var pairFeatureNames = [...]string{"date_gap_days", "payee_similarity", "amount_delta"}
+
+// pairFeatures returns the features of a and b, in the order of
+// pairFeatureNames
+func pairFeatures(a, b *Tx) [len(pairFeatureNames)]float64 {
+	return [...]float64{
+		float64(daysApart(a.Date, b.Date)),
+		dedupe.PayeeSimilarity(a.Payee, b.Payee),
+		amountDelta(a, b),
+	}
+}
+
+// A scoringModel tells duplicates apart from the features of pairs, with a
+// linear score and bounds on features
+type scoringModel struct {
+	linear    bool
+	intercept float64
+	weights   [len(pairFeatureNames)]float64
+	min, max  [len(pairFeatureNames)]float64
+}
+
+// loadWeights reads a scoring model from the file path, made of
+// "name = value" lines and "#" comments, like
+//
+//	# Trained on pairs.csv
+//	intercept = 2.1
+//	date_gap_days = -0.6
+//	payee_similarity = 1.8
+//	max_amount_delta = 0.5
+//
+// where a feature name sets its weight and min_ or max_ before it a bound.
+func loadWeights(path string) (*scoringModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &scoringModel{}
+	for i := range pairFeatureNames {
+		m.min[i], m.max[i] = math.Inf(-1), math.Inf(1)
+	}
+	feature := func(name string) int {
+		for i, n := range pairFeatureNames {
+			if n == name {
+				return i
+			}
+		}
+		return -1
+	}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%v:%v: expected name = value", path, line)
+		}
+		name = strings.TrimSpace(name)
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", path, line, err)
+		}
+		switch {
+		case name == "intercept":
+			m.linear, m.intercept = true, v
+		case feature(name) >= 0:
+			m.linear, m.weights[feature(name)] = true, v
+		case strings.HasPrefix(name, "min_") && feature(name[4:]) >= 0:
+			m.min[feature(name[4:])] = v
+		case strings.HasPrefix(name, "max_") && feature(name[4:]) >= 0:
+			m.max[feature(name[4:])] = v
+		default:
+			return nil, fmt.Errorf("%v:%v: unknown weight %q, expected intercept or a feature, optionally after min_ or max_: %v",
+				path, line, name, strings.Join(pairFeatureNames[:], ", "))
+		}
+	}
+	return m, scanner.Err()
+}
+
+// matcher matches pairs with features within the bounds of m and, when m has
+// weights, a positive score: the intercept plus the features times their
+// weights
+func (m *scoringModel) matcher() Matcher {
+	return func(a, b *Tx) bool {
+		features := pairFeatures(a, b)
+		score := m.intercept
+		for i, f := range features {
+			if f < m.min[i] || f > m.max[i] {
+				return false
+			}
+			score += m.weights[i] * f
+		}
+		return !m.linear || score > 0
+	}
+}
@@ -0,0 +1,95 @@
+/*
+	ledger lint duplicate finds duplicates transactions in your ledger file.
+	Copyright © 2021 Clément Joly
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// workspaceFlag holds the names and configuration files of -workspace
+type workspaceFlag map[string]string
+
+func (w workspaceFlag) String() string {
+	var s []string
+	for name, config := range w {
+		s = append(s, name+"="+config)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (w workspaceFlag) Set(value string) error {
+	name, config, ok := strings.Cut(value, "=")
+	if !ok || name == "" || config == "" {
+		return fmt.Errorf("expected name=file, got %q", value)
+	}
+	w[name] = config
+	return nil
+}
+
+func (w workspaceFlag) reset() {
+	for name := range w {
+		delete(w, name)
+	}
+}
+
+// loadWorkspace builds the index of a workspace from its configuration
+// file, which sets the ledger to read with file-set and may set the other
+// settings that apply to the index. Unset ones default to those of the
+// default workspace.
+func loadWorkspace(config string) (*Index, error) {
+	fs := flag.NewFlagSet(config, flag.ContinueOnError)
+	fileSet := fs.String("file-set", "", "")
+	days := fs.Float64("days", *days, "")
+	scriptPath := fs.String("script", *scriptPath, "")
+	lenient := fs.Bool("lenient", *lenient, "")
+	ledgerArgs := fs.String("ledger-args", *ledgerArgs, "")
+	if err := loadConfig(config, fs, nil, true); err != nil {
+		return nil, err
+	}
+	if *fileSet == "" {
+		return nil, fmt.Errorf("%v: no file-set", config)
+	}
+
+	fileNames, err := expandFileSet(*fileSet)
+	if err != nil {
+		return nil, err
+	}
+	txs, _, err := mergeInputs(loadFiles(*jobs, *ledgerArgs, *lenient, fileNames))
+	if err != nil {
+		return nil, err
+	}
+	var s *script
+	if *scriptPath != "" {
+		if s, err = loadScript(*scriptPath); err != nil {
+			return nil, err
+		}
+		if err := s.filter(txs); err != nil {
+			return nil, err
+		}
+	}
+	settings, err := scanSettings(*days, s)
+	if err != nil {
+		return nil, err
+	}
+	return newIndex(settings, txs), nil
+}